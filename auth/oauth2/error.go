@@ -0,0 +1,49 @@
+package oauth2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// RFC 6749 第 5.2 节定义的错误码, 可以通过 errors.Is 与 Error 比较
+var (
+	ErrInvalidRequest       = errors.New("invalid_request")
+	ErrInvalidClient        = errors.New("invalid_client")
+	ErrInvalidGrant         = errors.New("invalid_grant")
+	ErrUnauthorizedClient   = errors.New("unauthorized_client")
+	ErrUnsupportedGrantType = errors.New("unsupported_grant_type")
+	ErrInvalidScope         = errors.New("invalid_scope")
+)
+
+var errorCodes = map[string]error{
+	"invalid_request":        ErrInvalidRequest,
+	"invalid_client":         ErrInvalidClient,
+	"invalid_grant":          ErrInvalidGrant,
+	"unauthorized_client":    ErrUnauthorizedClient,
+	"unsupported_grant_type": ErrUnsupportedGrantType,
+	"invalid_scope":          ErrInvalidScope,
+}
+
+// Error 令牌接口返回的错误响应, 响应体无法解析时 Code 为空, 可以从 Body 查看原始内容
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+	URI         string
+	Body        []byte
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("oauth2: token endpoint returned status %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("oauth2: %s (status %d)", e.Code, e.StatusCode)
+	}
+	return fmt.Sprintf("oauth2: %s: %s (status %d)", e.Code, e.Description, e.StatusCode)
+}
+
+func (e *Error) Is(target error) bool {
+	sentinel, ok := errorCodes[e.Code]
+	return ok && target == sentinel
+}
@@ -0,0 +1,110 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// signingMethod 根据私钥类型选择 JWT 签名算法
+type signingMethod struct {
+	alg  string
+	hash crypto.Hash
+	// size ECDSA 签名中 r, s 各自的字节数
+	size int
+}
+
+func newSigningMethod(key crypto.Signer) (signingMethod, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return signingMethod{alg: "RS256", hash: crypto.SHA256}, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return signingMethod{alg: "ES256", hash: crypto.SHA256, size: 32}, nil
+		case elliptic.P384():
+			return signingMethod{alg: "ES384", hash: crypto.SHA384, size: 48}, nil
+		case elliptic.P521():
+			return signingMethod{alg: "ES512", hash: crypto.SHA512, size: 66}, nil
+		}
+		return signingMethod{}, errors.Errorf("unsupported ecdsa curve %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return signingMethod{alg: "EdDSA"}, nil
+	default:
+		return signingMethod{}, errors.Errorf("unsupported signing key type %T", pub)
+	}
+}
+
+// signJWT 使用 key 签名 claims, 返回紧凑格式的 JWT
+func signJWT(key crypto.Signer, keyID string, claims map[string]interface{}) (string, error) {
+	if key == nil {
+		return "", errors.New("private key is required to sign jwt")
+	}
+	method, err := newSigningMethod(key)
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]interface{}{"alg": method.alg, "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", errors.Wrap(err, "encode jwt header failed")
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "encode jwt claims failed")
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	// Ed25519 对原文签名, 其他算法对摘要签名
+	message := []byte(signingInput)
+	if method.hash != 0 {
+		hash := method.hash.New()
+		hash.Write(message)
+		message = hash.Sum(nil)
+	}
+	signature, err := key.Sign(rand.Reader, message, method.hash)
+	if err != nil {
+		return "", errors.Wrap(err, "sign jwt failed")
+	}
+	if method.size > 0 {
+		if signature, err = ecdsaRawSignature(signature, method.size); err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ecdsaRawSignature 把 ASN.1 DER 格式的 ECDSA 签名转换为 JWS 要求的 r||s 定长格式
+func ecdsaRawSignature(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, errors.Wrap(err, "decode ecdsa signature failed")
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generate jti failed")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,396 @@
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/artisancloud/httphelper"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// AuthStyle 客户端认证方式
+type AuthStyle int
+
+const (
+	// AuthStyleClientSecretBasic client_id 与 client_secret 通过 HTTP Basic 认证发送
+	AuthStyleClientSecretBasic AuthStyle = iota
+	// AuthStyleClientSecretPost client_id 与 client_secret 放在表单中
+	AuthStyleClientSecretPost
+	// AuthStylePrivateKeyJWT 使用 PrivateKey 签名的 JWT 断言认证(RFC 7523)
+	AuthStylePrivateKeyJWT
+)
+
+type Config struct {
+	// TokenURL 令牌接口地址
+	TokenURL string
+	// ClientID 为空时不进行客户端认证
+	ClientID     string
+	ClientSecret string
+	// AuthStyle 客户端认证方式, 默认 AuthStyleClientSecretBasic
+	AuthStyle AuthStyle
+	// Scopes 申请的权限范围
+	Scopes []string
+	// EndpointParams 附加到每次令牌请求的参数, 例如 audience, resource
+	EndpointParams url.Values
+
+	// PrivateKey private_key_jwt 认证与 jwt-bearer 授权签名使用的私钥, 支持 RSA, ECDSA 与 Ed25519
+	PrivateKey crypto.Signer
+	// KeyID 写入 JWT 头部的 kid
+	KeyID string
+	// Audience JWT 断言的 aud, 默认 TokenURL
+	Audience string
+	// AssertionLifetime JWT 断言的有效期, 默认 5 分钟
+	AssertionLifetime time.Duration
+
+	// Helper 请求令牌接口使用的 Helper, 默认新建, 不能带有使用本客户端令牌的中间件
+	Helper httphelper.Helper
+}
+
+func (c *Config) Default() {
+	if c.Audience == "" {
+		c.Audience = c.TokenURL
+	}
+	if c.AssertionLifetime <= 0 {
+		c.AssertionLifetime = 5 * time.Minute
+	}
+}
+
+// Token 令牌接口返回的令牌
+type Token struct {
+	httphelper.Token
+	RefreshToken string
+	Scope        string
+	// Raw 令牌接口返回的全部字段, 例如 id_token
+	Raw map[string]interface{}
+}
+
+// Client OAuth2 客户端, 通过 RequestHelper 请求令牌接口
+type Client struct {
+	config Config
+	helper httphelper.Helper
+	now    func() time.Time
+}
+
+func NewClient(config Config) (*Client, error) {
+	config.Default()
+	if config.TokenURL == "" {
+		return nil, errors.New("token url is required")
+	}
+	if config.AuthStyle == AuthStylePrivateKeyJWT && config.PrivateKey == nil {
+		return nil, errors.New("private key is required for private_key_jwt")
+	}
+	helper := config.Helper
+	if helper == nil {
+		var err error
+		if helper, err = httphelper.NewRequestHelper(&httphelper.Config{}); err != nil {
+			return nil, err
+		}
+	}
+	return &Client{config: config, helper: helper, now: time.Now}, nil
+}
+
+// ClientCredentials 使用 client_credentials 授权获取令牌
+func (c *Client) ClientCredentials(ctx context.Context) (*Token, error) {
+	values := url.Values{"grant_type": {GrantTypeClientCredentials}}
+	c.setScope(values)
+	return c.Exchange(ctx, values)
+}
+
+// RefreshToken 使用 refresh_token 授权获取令牌, 服务端没有返回新的 refresh_token 时沿用原来的
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	if refreshToken == "" {
+		return nil, errors.New("refresh token is empty")
+	}
+	token, err := c.Exchange(ctx, url.Values{
+		"grant_type":    {GrantTypeRefreshToken},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// JWTBearer 使用 jwt-bearer 授权(RFC 7523)获取令牌, 断言由 PrivateKey 签名, iss 为 ClientID, claims 中的字段会覆盖默认声明
+func (c *Client) JWTBearer(ctx context.Context, subject string, claims map[string]interface{}) (*Token, error) {
+	assertionClaims := map[string]interface{}{"iss": c.config.ClientID}
+	if subject != "" {
+		assertionClaims["sub"] = subject
+	}
+	for key, value := range claims {
+		assertionClaims[key] = value
+	}
+	assertion, err := c.assertion(assertionClaims)
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{
+		"grant_type": {GrantTypeJWTBearer},
+		"assertion":  {assertion},
+	}
+	c.setScope(values)
+	return c.Exchange(ctx, values)
+}
+
+// Exchange 发送令牌请求, values 为授权参数, 客户端认证与 EndpointParams 会自动添加
+func (c *Client) Exchange(ctx context.Context, values url.Values) (*Token, error) {
+	form := url.Values{}
+	for key, value := range c.config.EndpointParams {
+		form[key] = value
+	}
+	for key, value := range values {
+		form[key] = value
+	}
+
+	df := c.helper.Df().WithContext(ctx).
+		Method(http.MethodPost).
+		Url(c.config.TokenURL)
+	if err := c.authenticate(df, form); err != nil {
+		return nil, err
+	}
+	response, err := df.
+		Header("Content-Type", "application/x-www-form-urlencoded").
+		Body(strings.NewReader(form.Encode())).
+		Request()
+	if err != nil {
+		return nil, errors.Wrap(err, "token request failed")
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read token response failed")
+	}
+	return c.parseToken(response, body)
+}
+
+func (c *Client) setScope(values url.Values) {
+	if len(c.config.Scopes) > 0 {
+		values.Set("scope", strings.Join(c.config.Scopes, " "))
+	}
+}
+
+// authenticate 按 AuthStyle 添加客户端认证信息
+func (c *Client) authenticate(df dataflow.RequestDataflow, form url.Values) error {
+	if c.config.ClientID == "" {
+		return nil
+	}
+	switch c.config.AuthStyle {
+	case AuthStyleClientSecretPost:
+		form.Set("client_id", c.config.ClientID)
+		if c.config.ClientSecret != "" {
+			form.Set("client_secret", c.config.ClientSecret)
+		}
+	case AuthStylePrivateKeyJWT:
+		assertion, err := c.assertion(map[string]interface{}{
+			"iss": c.config.ClientID,
+			"sub": c.config.ClientID,
+		})
+		if err != nil {
+			return err
+		}
+		form.Set("client_id", c.config.ClientID)
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	default:
+		// 没有密钥的公开客户端只发送 client_id
+		if c.config.ClientSecret == "" {
+			form.Set("client_id", c.config.ClientID)
+			return nil
+		}
+		// RFC 6749 第 2.3.1 节要求先进行表单编码
+		credentials := url.QueryEscape(c.config.ClientID) + ":" + url.QueryEscape(c.config.ClientSecret)
+		df.Header("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	return nil
+}
+
+// assertion 签名 JWT 断言, 补充 aud, iat, exp 与 jti
+func (c *Client) assertion(claims map[string]interface{}) (string, error) {
+	now := c.now()
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+	defaults := map[string]interface{}{
+		"aud": c.config.Audience,
+		"iat": now.Unix(),
+		"exp": now.Add(c.config.AssertionLifetime).Unix(),
+		"jti": jti,
+	}
+	for key, value := range defaults {
+		if _, ok := claims[key]; !ok {
+			claims[key] = value
+		}
+	}
+	return signJWT(c.config.PrivateKey, c.config.KeyID, claims)
+}
+
+// parseToken 解析 JSON 或表单格式的令牌响应, 错误响应返回 *Error
+func (c *Client) parseToken(response *http.Response, body []byte) (*Token, error) {
+	raw := make(map[string]interface{})
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "text/plain":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "decode token response failed")
+		}
+		for key := range values {
+			raw[key] = values.Get(key)
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&raw); err != nil {
+			if response.StatusCode < 200 || response.StatusCode > 299 {
+				return nil, &Error{StatusCode: response.StatusCode, Body: body}
+			}
+			return nil, errors.Wrap(err, "decode token response failed")
+		}
+	}
+
+	// 部分服务端在 200 响应中返回错误
+	if code := stringField(raw, "error"); code != "" || response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &Error{
+			StatusCode:  response.StatusCode,
+			Code:        code,
+			Description: stringField(raw, "error_description"),
+			URI:         stringField(raw, "error_uri"),
+			Body:        body,
+		}
+	}
+
+	token := &Token{
+		Token: httphelper.Token{
+			AccessToken: stringField(raw, "access_token"),
+			TokenType:   stringField(raw, "token_type"),
+		},
+		RefreshToken: stringField(raw, "refresh_token"),
+		Scope:        stringField(raw, "scope"),
+		Raw:          raw,
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response missing access_token")
+	}
+	// 服务端返回的 token_type 大小写不一, 统一使用 Bearer
+	if strings.EqualFold(token.TokenType, "bearer") {
+		token.TokenType = "Bearer"
+	}
+	if expiresIn := stringField(raw, "expires_in"); expiresIn != "" {
+		seconds, err := strconv.ParseInt(expiresIn, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid expires_in %q", expiresIn)
+		}
+		if seconds > 0 {
+			token.ExpiresAt = c.now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	return token, nil
+}
+
+// stringField 读取字符串或数字字段
+func stringField(raw map[string]interface{}, key string) string {
+	switch v := raw[key].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+// ClientCredentialsSource 返回使用 client_credentials 授权的 TokenProvider
+func (c *Client) ClientCredentialsSource() httphelper.TokenProvider {
+	return httphelper.TokenProviderFunc(func(ctx context.Context) (*httphelper.Token, error) {
+		token, err := c.ClientCredentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &token.Token, nil
+	})
+}
+
+// JWTBearerSource 返回使用 jwt-bearer 授权的 TokenProvider
+func (c *Client) JWTBearerSource(subject string, claims map[string]interface{}) httphelper.TokenProvider {
+	return httphelper.TokenProviderFunc(func(ctx context.Context) (*httphelper.Token, error) {
+		copied := make(map[string]interface{}, len(claims))
+		for key, value := range claims {
+			copied[key] = value
+		}
+		token, err := c.JWTBearer(ctx, subject, copied)
+		if err != nil {
+			return nil, err
+		}
+		return &token.Token, nil
+	})
+}
+
+// RefreshTokenSource 使用 refresh_token 授权的 TokenProvider, 服务端轮换 refresh_token 时保存新的值
+type RefreshTokenSource struct {
+	client *Client
+	// OnRotate refresh_token 变化时回调, 可以用来持久化
+	OnRotate func(refreshToken string)
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (c *Client) RefreshTokenSource(refreshToken string) *RefreshTokenSource {
+	return &RefreshTokenSource{client: c, refreshToken: refreshToken}
+}
+
+func (s *RefreshTokenSource) Token(ctx context.Context) (*httphelper.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.client.RefreshToken(ctx, s.refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != s.refreshToken {
+		s.refreshToken = token.RefreshToken
+		if s.OnRotate != nil {
+			s.OnRotate(token.RefreshToken)
+		}
+	}
+	return &token.Token, nil
+}
+
+// RefreshToken 返回当前的 refresh_token
+func (s *RefreshTokenSource) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshToken
+}
+
+// BearerMiddleware 通过 config.Provider 获取令牌并写入 Authorization: Bearer 请求头,
+// 令牌缓存, 提前刷新与 401 时重试由 httphelper.TokenMiddleware 完成
+func BearerMiddleware(config httphelper.TokenConfig) dataflow.RequestMiddleware {
+	if config.Inject == nil {
+		config.Inject = httphelper.InjectTokenHeader("Authorization", "Bearer")
+	}
+	return httphelper.TokenMiddleware(config)
+}
@@ -0,0 +1,348 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/artisancloud/httphelper"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer 记录最后一次令牌请求, 由 handler 决定响应
+type tokenServer struct {
+	*httptest.Server
+	calls   int32
+	form    url.Values
+	request *http.Request
+}
+
+func newTokenServer(t *testing.T, handler func(w http.ResponseWriter, form url.Values)) *tokenServer {
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		_ = r.ParseForm()
+		s.form = r.PostForm
+		s.request = r
+		handler(w, r.PostForm)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func newTestClient(t *testing.T, config Config) *Client {
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// verifyJWT 校验签名并返回载荷
+func verifyJWT(t *testing.T, token string, key crypto.PublicKey) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if !assert.Len(t, parts, 3) {
+		t.FailNow()
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	signingInput := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signingInput)
+
+	var valid bool
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		valid = len(signature) == 64 && ecdsa.Verify(pub, digest[:], r, s)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(pub, signingInput, signature)
+	}
+	assert.True(t, valid, "invalid jwt signature")
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	claims := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func TestClient_ClientCredentials_Basic(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "at-1",
+			"token_type":   "bearer",
+			"expires_in":   3600,
+			"scope":        "read write",
+		})
+	})
+	c := newTestClient(t, Config{
+		TokenURL:       server.URL,
+		ClientID:       "client id",
+		ClientSecret:   "s3cr:t",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: url.Values{"audience": {"https://api.example.com"}},
+	})
+
+	token, err := c.ClientCredentials(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "at-1", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, "read write", token.Scope)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, 5*time.Second)
+
+	assert.Equal(t, "client_credentials", server.form.Get("grant_type"))
+	assert.Equal(t, "read write", server.form.Get("scope"))
+	assert.Equal(t, "https://api.example.com", server.form.Get("audience"))
+	assert.Empty(t, server.form.Get("client_secret"))
+	// client_id 与 client_secret 先进行表单编码
+	id, secret, ok := server.request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "client+id", id)
+	assert.Equal(t, "s3cr%3At", secret)
+}
+
+func TestClient_ClientCredentials_Post(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		// 表单格式的响应, expires_in 为字符串
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		_, _ = w.Write([]byte("access_token=at-1&token_type=bearer&expires_in=60"))
+	})
+	c := newTestClient(t, Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthStyle:    AuthStyleClientSecretPost,
+	})
+
+	token, err := c.ClientCredentials(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "at-1", token.AccessToken)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), token.ExpiresAt, 5*time.Second)
+	assert.Equal(t, "client", server.form.Get("client_id"))
+	assert.Equal(t, "secret", server.form.Get("client_secret"))
+	assert.Empty(t, server.request.Header.Get("Authorization"))
+}
+
+func TestClient_PrivateKeyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey, edKey} {
+		server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "at", "token_type": "Bearer"})
+		})
+		c := newTestClient(t, Config{
+			TokenURL:   server.URL,
+			ClientID:   "client",
+			AuthStyle:  AuthStylePrivateKeyJWT,
+			PrivateKey: key,
+			KeyID:      "key-1",
+		})
+
+		_, err = c.ClientCredentials(context.Background())
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, "client", server.form.Get("client_id"))
+		assert.Equal(t, clientAssertionType, server.form.Get("client_assertion_type"))
+		assert.Empty(t, server.request.Header.Get("Authorization"))
+
+		assertion := server.form.Get("client_assertion")
+		header, _ := base64.RawURLEncoding.DecodeString(strings.Split(assertion, ".")[0])
+		assert.Contains(t, string(header), `"kid":"key-1"`)
+		claims := verifyJWT(t, assertion, key.Public())
+		assert.Equal(t, "client", claims["iss"])
+		assert.Equal(t, "client", claims["sub"])
+		assert.Equal(t, server.URL, claims["aud"])
+		assert.NotEmpty(t, claims["jti"])
+		assert.Equal(t, claims["iat"].(float64)+300, claims["exp"])
+	}
+}
+
+func TestClient_JWTBearer(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "at", "token_type": "Bearer", "expires_in": "120"})
+	})
+	// 不设置 ClientID 时不进行客户端认证, 断言的 iss 由 claims 指定
+	c := newTestClient(t, Config{
+		TokenURL:   server.URL,
+		PrivateKey: key,
+		Scopes:     []string{"email"},
+	})
+
+	token, err := c.JWTBearer(context.Background(), "user@example.com", map[string]interface{}{
+		"iss": "service@example.com",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), token.ExpiresAt, 5*time.Second)
+	assert.Equal(t, GrantTypeJWTBearer, server.form.Get("grant_type"))
+	assert.Equal(t, "email", server.form.Get("scope"))
+	assert.Empty(t, server.form.Get("client_id"))
+	assert.Empty(t, server.request.Header.Get("Authorization"))
+
+	claims := verifyJWT(t, server.form.Get("assertion"), key.Public())
+	assert.Equal(t, "service@example.com", claims["iss"])
+	assert.Equal(t, "user@example.com", claims["sub"])
+	assert.Equal(t, server.URL, claims["aud"])
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		switch form.Get("refresh_token") {
+		case "rt-1":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "at-1", "refresh_token": "rt-2", "expires_in": 3600})
+		case "rt-2":
+			// 没有返回新的 refresh_token 时沿用原来的
+			writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "at-2", "expires_in": 3600})
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_grant"})
+		}
+	})
+	c := newTestClient(t, Config{TokenURL: server.URL, ClientID: "public-client"})
+
+	var rotated []string
+	source := c.RefreshTokenSource("rt-1")
+	source.OnRotate = func(refreshToken string) {
+		rotated = append(rotated, refreshToken)
+	}
+
+	token, err := source.Token(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "at-1", token.AccessToken)
+	}
+	assert.Equal(t, "refresh_token", server.form.Get("grant_type"))
+	assert.Equal(t, "public-client", server.form.Get("client_id"))
+
+	token, err = source.Token(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "at-2", token.AccessToken)
+	}
+	assert.Equal(t, "rt-2", source.RefreshToken())
+	assert.Equal(t, []string{"rt-2"}, rotated)
+}
+
+func TestClient_Error(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		switch form.Get("grant_type") {
+		case GrantTypeRefreshToken:
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":             "invalid_grant",
+				"error_description": "refresh token expired",
+				"error_uri":         "https://example.com/errors/invalid_grant",
+			})
+		case GrantTypeClientCredentials:
+			// 部分服务端在 200 响应中返回错误
+			writeJSON(w, http.StatusOK, map[string]interface{}{"error": "invalid_scope"})
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("<html>bad gateway</html>"))
+		}
+	})
+	c := newTestClient(t, Config{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret"})
+
+	_, err := c.RefreshToken(context.Background(), "rt")
+	assert.True(t, errors.Is(err, ErrInvalidGrant))
+	assert.False(t, errors.Is(err, ErrInvalidClient))
+	var oauthErr *Error
+	if assert.True(t, errors.As(err, &oauthErr)) {
+		assert.Equal(t, http.StatusBadRequest, oauthErr.StatusCode)
+		assert.Equal(t, "refresh token expired", oauthErr.Description)
+		assert.Equal(t, "https://example.com/errors/invalid_grant", oauthErr.URI)
+	}
+	assert.EqualError(t, err, "oauth2: invalid_grant: refresh token expired (status 400)")
+
+	_, err = c.ClientCredentials(context.Background())
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+
+	_, err = c.Exchange(context.Background(), url.Values{"grant_type": {"password"}})
+	if assert.True(t, errors.As(err, &oauthErr)) {
+		assert.Equal(t, http.StatusBadGateway, oauthErr.StatusCode)
+		assert.Empty(t, oauthErr.Code)
+		assert.Equal(t, "<html>bad gateway</html>", string(oauthErr.Body))
+	}
+}
+
+func TestBearerMiddleware(t *testing.T) {
+	var issued int32
+	tokenSrv := newTokenServer(t, func(w http.ResponseWriter, form url.Values) {
+		n := atomic.AddInt32(&issued, 1)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "at-" + strconv.Itoa(int(n)),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	})
+	// 第一个令牌被服务端吊销
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer at-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	c := newTestClient(t, Config{TokenURL: tokenSrv.URL, ClientID: "client", ClientSecret: "secret"})
+	helper, err := httphelper.NewRequestHelper(&httphelper.Config{BaseUrl: api.URL})
+	if !assert.NoError(t, err) {
+		return
+	}
+	helper.WithMiddleware(BearerMiddleware(httphelper.TokenConfig{Provider: c.ClientCredentialsSource()}))
+
+	for i := 0; i < 3; i++ {
+		res, err := helper.Df().Uri("/resource").Request()
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "Bearer at-2", string(body))
+		}
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenSrv.calls))
+}
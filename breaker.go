@@ -0,0 +1,318 @@
+package httphelper
+
+import (
+	"context"
+	"fmt"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器处于打开状态时请求被直接拒绝, 可以通过 errors.Is 判断
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError 熔断拒绝错误, 包含被熔断的 key 与预计恢复探测的时间
+type CircuitOpenError struct {
+	Key     string
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for %q until %s", e.Key, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerConfig struct {
+	// KeyFunc 熔断维度, 默认 KeyByHost
+	KeyFunc func(request *http.Request) string
+	// Window 统计失败率的滚动窗口, 默认 10s
+	Window time.Duration
+	// Buckets 滚动窗口划分的桶数, 默认 10
+	Buckets int
+	// MinRequests 窗口内请求数达到该值才会计算失败率, 默认 20
+	MinRequests int
+	// FailureRateThreshold 失败率达到该值时打开熔断, 默认 0.5
+	FailureRateThreshold float64
+	// CoolDown 打开状态持续多久后进入半开状态, 默认 30s
+	CoolDown time.Duration
+	// HalfOpenProbes 半开状态允许的探测请求数, 全部成功后关闭熔断, 默认 1
+	HalfOpenProbes int
+	// IsFailure 判断一次请求是否失败, 默认网络错误或 5xx 视为失败, 主动取消的请求既不算成功也不算失败
+	IsFailure func(response *http.Response, err error) bool
+	// OnStateChange 状态变化回调, 在锁外同步调用
+	OnStateChange func(key string, from CircuitState, to CircuitState)
+}
+
+func (c *CircuitBreakerConfig) Default() {
+	if c.KeyFunc == nil {
+		c.KeyFunc = KeyByHost
+	}
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 10
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.FailureRateThreshold <= 0 || c.FailureRateThreshold > 1 {
+		c.FailureRateThreshold = 0.5
+	}
+	if c.CoolDown <= 0 {
+		c.CoolDown = 30 * time.Second
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = defaultIsFailure
+	}
+}
+
+func defaultIsFailure(response *http.Response, err error) bool {
+	return err != nil || response.StatusCode >= http.StatusInternalServerError
+}
+
+// CircuitBreaker 按 key 维护熔断状态的熔断器
+type CircuitBreaker struct {
+	config   CircuitBreakerConfig
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	config.Default()
+	return &CircuitBreaker{
+		config:   config,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// CircuitBreakerMiddleware 创建熔断器并返回其中间件
+func CircuitBreakerMiddleware(config CircuitBreakerConfig) dataflow.RequestMiddleware {
+	return NewCircuitBreaker(config).Middleware()
+}
+
+func (b *CircuitBreaker) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			key := b.config.KeyFunc(request)
+			generation, err := b.allow(key)
+			if err != nil {
+				return err
+			}
+
+			err = handle(request, response)
+			if errors.Is(err, context.Canceled) {
+				b.release(key, generation)
+				return err
+			}
+			b.record(key, generation, b.config.IsFailure(response, err))
+			return err
+		}
+	}
+}
+
+// State 返回 key 当前的熔断状态
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	c, ok := b.circuits[key]
+	if !ok {
+		b.mu.Unlock()
+		return CircuitClosed
+	}
+	transition := c.refresh(b.now(), &b.config)
+	state := c.state
+	b.mu.Unlock()
+
+	b.notify(key, transition)
+	return state
+}
+
+func (b *CircuitBreaker) getCircuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{buckets: make([]circuitBucket, b.config.Buckets)}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+func (b *CircuitBreaker) allow(key string) (uint64, error) {
+	b.mu.Lock()
+	now := b.now()
+	c := b.getCircuit(key)
+	transition := c.refresh(now, &b.config)
+
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = &CircuitOpenError{Key: key, RetryAt: c.openedAt.Add(b.config.CoolDown)}
+	case CircuitHalfOpen:
+		if c.probes >= b.config.HalfOpenProbes {
+			err = &CircuitOpenError{Key: key, RetryAt: now}
+		} else {
+			c.probes++
+		}
+	}
+	generation := c.generation
+	b.mu.Unlock()
+
+	b.notify(key, transition)
+	return generation, err
+}
+
+func (b *CircuitBreaker) record(key string, generation uint64, failed bool) {
+	b.mu.Lock()
+	now := b.now()
+	c := b.getCircuit(key)
+	transition := c.refresh(now, &b.config)
+	if c.generation == generation {
+		switch c.state {
+		case CircuitClosed:
+			c.add(now, failed, &b.config)
+			if c.shouldTrip(now, &b.config) {
+				transition = c.setState(CircuitOpen, now)
+			}
+		case CircuitHalfOpen:
+			if failed {
+				transition = c.setState(CircuitOpen, now)
+			} else {
+				c.successes++
+				if c.successes >= b.config.HalfOpenProbes {
+					transition = c.setState(CircuitClosed, now)
+				}
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(key, transition)
+}
+
+// release 请求被主动取消, 无法说明服务是否正常, 只归还半开状态的探测名额
+func (b *CircuitBreaker) release(key string, generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.getCircuit(key)
+	if c.generation == generation && c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+func (b *CircuitBreaker) notify(key string, transition *circuitTransition) {
+	if transition == nil || b.config.OnStateChange == nil {
+		return
+	}
+	b.config.OnStateChange(key, transition.from, transition.to)
+}
+
+type circuitTransition struct {
+	from CircuitState
+	to   CircuitState
+}
+
+type circuitBucket struct {
+	start    int64
+	requests int
+	failures int
+}
+
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	openedAt   time.Time
+	buckets    []circuitBucket
+	// 半开状态下已放行与已成功的探测数
+	probes    int
+	successes int
+}
+
+// refresh 打开状态冷却结束后切换到半开
+func (c *circuit) refresh(now time.Time, config *CircuitBreakerConfig) *circuitTransition {
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= config.CoolDown {
+		return c.setState(CircuitHalfOpen, now)
+	}
+	return nil
+}
+
+func (c *circuit) setState(state CircuitState, now time.Time) *circuitTransition {
+	transition := &circuitTransition{from: c.state, to: state}
+	c.state = state
+	c.generation++
+	c.probes = 0
+	c.successes = 0
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	for i := range c.buckets {
+		c.buckets[i] = circuitBucket{}
+	}
+	return transition
+}
+
+func (c *circuit) bucketWidth(config *CircuitBreakerConfig) int64 {
+	width := int64(config.Window) / int64(len(c.buckets))
+	if width <= 0 {
+		width = 1
+	}
+	return width
+}
+
+func (c *circuit) add(now time.Time, failed bool, config *CircuitBreakerConfig) {
+	width := c.bucketWidth(config)
+	start := now.UnixNano() / width * width
+	bucket := &c.buckets[(now.UnixNano()/width)%int64(len(c.buckets))]
+	if bucket.start != start {
+		*bucket = circuitBucket{start: start}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+}
+
+func (c *circuit) shouldTrip(now time.Time, config *CircuitBreakerConfig) bool {
+	oldest := now.UnixNano() - int64(config.Window)
+	requests, failures := 0, 0
+	for _, bucket := range c.buckets {
+		if bucket.start <= oldest {
+			continue
+		}
+		requests += bucket.requests
+		failures += bucket.failures
+	}
+	if requests < config.MinRequests {
+		return false
+	}
+	return float64(failures)/float64(requests) >= config.FailureRateThreshold
+}
@@ -0,0 +1,111 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	now := time.Now()
+	var transitions []CircuitState
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		MinRequests: 2,
+		CoolDown:    time.Minute,
+		OnStateChange: func(key string, from CircuitState, to CircuitState) {
+			assert.Equal(t, u.Host, key)
+			transitions = append(transitions, to)
+		},
+	})
+	breaker.now = func() time.Time { return now }
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(breaker.Middleware())
+
+	for i := 0; i < 2; i++ {
+		_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, CircuitOpen, breaker.State(u.Host))
+
+	// 打开状态下直接失败, 不会请求上游
+	_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// 冷却结束后半开探测成功, 熔断关闭
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&healthy, 1)
+	_, err = helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, breaker.State(u.Host))
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, transitions)
+}
+
+func TestCircuitBreaker_HalfOpenFailure(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		MinRequests: 1,
+		CoolDown:    time.Second,
+	})
+	breaker.now = func() time.Time { return now }
+
+	generation, err := breaker.allow("upstream")
+	assert.NoError(t, err)
+	breaker.record("upstream", generation, true)
+	assert.Equal(t, CircuitOpen, breaker.State("upstream"))
+
+	now = now.Add(time.Second)
+	generation, err = breaker.allow("upstream")
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitHalfOpen, breaker.State("upstream"))
+
+	// 半开状态只放行一个探测请求
+	_, err = breaker.allow("upstream")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	breaker.record("upstream", generation, true)
+	assert.Equal(t, CircuitOpen, breaker.State("upstream"))
+}
+
+func TestCircuitBreaker_HalfOpenCanceled(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		MinRequests: 1,
+		CoolDown:    time.Second,
+	})
+	breaker.now = func() time.Time { return now }
+
+	generation, err := breaker.allow("upstream")
+	assert.NoError(t, err)
+	breaker.record("upstream", generation, true)
+	now = now.Add(time.Second)
+
+	// 被取消的探测请求不关闭熔断, 并归还探测名额
+	handle := breaker.Middleware()(func(request *http.Request, response *http.Response) error {
+		return errors.Wrap(context.Canceled, "request failed")
+	})
+	request, _ := http.NewRequest(http.MethodGet, "http://upstream/", nil)
+	assert.ErrorIs(t, handle(request, new(http.Response)), context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, breaker.State("upstream"))
+
+	_, err = breaker.allow("upstream")
+	assert.NoError(t, err)
+}
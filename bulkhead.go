@@ -0,0 +1,240 @@
+package httphelper
+
+import (
+	"fmt"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrBulkheadFull 并发已满且等待队列已满, 请求被拒绝
+	ErrBulkheadFull = errors.New("bulkhead is full")
+	// ErrBulkheadTimeout 请求在等待队列中超时
+	ErrBulkheadTimeout = errors.New("bulkhead queue timeout")
+)
+
+// BulkheadRejectedError 舱壁拒绝错误, 可以通过 errors.Is 与 ErrBulkheadFull 或 ErrBulkheadTimeout 比较
+type BulkheadRejectedError struct {
+	Key     string
+	Timeout bool
+}
+
+func (e *BulkheadRejectedError) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("bulkhead queue timeout for %q", e.Key)
+	}
+	return fmt.Sprintf("bulkhead is full for %q", e.Key)
+}
+
+func (e *BulkheadRejectedError) Is(target error) bool {
+	if e.Timeout {
+		return target == ErrBulkheadTimeout
+	}
+	return target == ErrBulkheadFull
+}
+
+type BulkheadConfig struct {
+	// MaxConcurrent 全局最大并发请求数, 0 表示不限制
+	MaxConcurrent int
+	// MaxConcurrentPerKey 每个 key 的最大并发请求数, 0 表示不限制
+	MaxConcurrentPerKey int
+	// MaxQueue 所有 key 共享的等待队列长度, 默认 100, 小于 0 表示不排队直接拒绝
+	MaxQueue int
+	// QueueTimeout 在队列中等待的最长时间, 0 表示只受请求 context 限制
+	QueueTimeout time.Duration
+	// KeyFunc 并发隔离维度, 默认 KeyByHost
+	KeyFunc func(request *http.Request) string
+}
+
+func (c *BulkheadConfig) Default() {
+	if c.MaxQueue == 0 {
+		c.MaxQueue = 100
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = KeyByHost
+	}
+}
+
+// BulkheadGauge 并发与排队数量快照
+type BulkheadGauge struct {
+	InFlight int64
+	Queued   int64
+}
+
+// Bulkhead 按 key 与全局限制并发请求数的舱壁隔离器
+type Bulkhead struct {
+	// 64 位原子计数放在结构体开头以保证在 32 位平台上对齐
+	inFlight     int64
+	queued       int64
+	config       BulkheadConfig
+	global       chan struct{}
+	mu           sync.Mutex
+	compartments map[string]*compartment
+}
+
+type compartment struct {
+	inFlight int64
+	queued   int64
+	sem      chan struct{}
+	refs     int
+}
+
+func NewBulkhead(config BulkheadConfig) *Bulkhead {
+	config.Default()
+	b := &Bulkhead{
+		config:       config,
+		compartments: make(map[string]*compartment),
+	}
+	if config.MaxConcurrent > 0 {
+		b.global = make(chan struct{}, config.MaxConcurrent)
+	}
+	return b
+}
+
+// BulkheadMiddleware 创建舱壁隔离器并返回其中间件
+func BulkheadMiddleware(config BulkheadConfig) dataflow.RequestMiddleware {
+	return NewBulkhead(config).Middleware()
+}
+
+func (b *Bulkhead) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			key := b.config.KeyFunc(request)
+			c := b.retain(key)
+			defer b.release(key)
+
+			if err := b.acquire(request, key, c); err != nil {
+				return err
+			}
+			atomic.AddInt64(&b.inFlight, 1)
+			atomic.AddInt64(&c.inFlight, 1)
+			defer func() {
+				atomic.AddInt64(&b.inFlight, -1)
+				atomic.AddInt64(&c.inFlight, -1)
+				releaseSem(c.sem)
+				releaseSem(b.global)
+			}()
+
+			return handle(request, response)
+		}
+	}
+}
+
+// Gauge 返回全局并发与排队数量
+func (b *Bulkhead) Gauge() BulkheadGauge {
+	return BulkheadGauge{
+		InFlight: atomic.LoadInt64(&b.inFlight),
+		Queued:   atomic.LoadInt64(&b.queued),
+	}
+}
+
+// KeyGauges 返回每个活跃 key 的并发与排队数量
+func (b *Bulkhead) KeyGauges() map[string]BulkheadGauge {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gauges := make(map[string]BulkheadGauge, len(b.compartments))
+	for key, c := range b.compartments {
+		gauges[key] = BulkheadGauge{
+			InFlight: atomic.LoadInt64(&c.inFlight),
+			Queued:   atomic.LoadInt64(&c.queued),
+		}
+	}
+	return gauges
+}
+
+func (b *Bulkhead) retain(key string) *compartment {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.compartments[key]
+	if !ok {
+		c = &compartment{}
+		if b.config.MaxConcurrentPerKey > 0 {
+			c.sem = make(chan struct{}, b.config.MaxConcurrentPerKey)
+		}
+		b.compartments[key] = c
+	}
+	c.refs++
+	return c
+}
+
+func (b *Bulkhead) release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.compartments[key]
+	c.refs--
+	if c.refs == 0 {
+		delete(b.compartments, key)
+	}
+}
+
+func (b *Bulkhead) acquire(request *http.Request, key string, c *compartment) error {
+	// 不排队直接获取
+	if tryAcquire(c.sem) {
+		if tryAcquire(b.global) {
+			return nil
+		}
+		releaseSem(c.sem)
+	}
+
+	if atomic.AddInt64(&b.queued, 1) > int64(b.config.MaxQueue) {
+		atomic.AddInt64(&b.queued, -1)
+		return &BulkheadRejectedError{Key: key}
+	}
+	atomic.AddInt64(&c.queued, 1)
+	defer func() {
+		atomic.AddInt64(&b.queued, -1)
+		atomic.AddInt64(&c.queued, -1)
+	}()
+
+	var timeout <-chan time.Time
+	if b.config.QueueTimeout > 0 {
+		timer := time.NewTimer(b.config.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	ctx := request.Context()
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+		case <-timeout:
+			return &BulkheadRejectedError{Key: key, Timeout: true}
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "bulkhead wait interrupted")
+		}
+	}
+	if b.global != nil {
+		select {
+		case b.global <- struct{}{}:
+		case <-timeout:
+			releaseSem(c.sem)
+			return &BulkheadRejectedError{Key: key, Timeout: true}
+		case <-ctx.Done():
+			releaseSem(c.sem)
+			return errors.Wrap(ctx.Err(), "bulkhead wait interrupted")
+		}
+	}
+	return nil
+}
+
+func tryAcquire(sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseSem(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
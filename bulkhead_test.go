@@ -0,0 +1,75 @@
+package httphelper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	bulkhead := NewBulkhead(BulkheadConfig{
+		MaxConcurrentPerKey: 1,
+		MaxQueue:            1,
+	})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(bulkhead.Middleware())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+			assert.NoError(t, err)
+		}()
+	}
+
+	<-arrived
+	assert.Eventually(t, func() bool {
+		return bulkhead.Gauge() == BulkheadGauge{InFlight: 1, Queued: 1}
+	}, time.Second, time.Millisecond)
+	assert.Len(t, bulkhead.KeyGauges(), 1)
+
+	// 并发与队列均已满
+	_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.ErrorIs(t, err, ErrBulkheadFull)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, BulkheadGauge{}, bulkhead.Gauge())
+	assert.Len(t, bulkhead.KeyGauges(), 0)
+}
+
+func TestBulkhead_QueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(BulkheadMiddleware(BulkheadConfig{
+		MaxConcurrent: 1,
+		QueueTimeout:  20 * time.Millisecond,
+	}))
+
+	go func() {
+		_, _ = helper.Df().Method(http.MethodGet).Uri("/").Request()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.ErrorIs(t, err, ErrBulkheadTimeout)
+}
@@ -0,0 +1,639 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/artisancloud/httphelper/dataflow"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	// Storage 缓存存储, 默认 64MB 的 MemoryCacheStorage
+	Storage CacheStorage
+	// Shared 按共享缓存处理, 不缓存 private 响应并使用 s-maxage, 默认按私有缓存处理
+	Shared bool
+	// HeuristicFraction 没有明确过期时间但有 Last-Modified 时, 新鲜期为 (Date - Last-Modified) 的比例, 默认 0.1
+	HeuristicFraction float64
+	// MaxHeuristic 启发式新鲜期的上限, 默认 24h
+	MaxHeuristic time.Duration
+	// MaxBodySize 超过该大小的响应不缓存, 默认 10MB
+	MaxBodySize int64
+	// KeyFunc 缓存 key, 默认为请求方法, 完整 URL 与 Authorization, Cookie 请求头的哈希
+	KeyFunc func(request *http.Request) string
+	// OnStorageError 读写缓存存储失败时回调, 失败时按未命中处理
+	OnStorageError func(err error)
+	// StaleWhileRevalidate 大于 0 时覆盖响应中的 stale-while-revalidate, 过期不超过该时长的缓存直接返回并在后台验证
+	StaleWhileRevalidate time.Duration
+	// StaleIfError 大于 0 时覆盖响应中的 stale-if-error, 服务端出错或返回 500/502/503/504 时,
+	// 使用过期不超过该时长的缓存
+	StaleIfError time.Duration
+	// RefreshTimeout 后台验证请求的超时, 默认 30s
+	RefreshTimeout time.Duration
+}
+
+func (c *CacheConfig) Default() {
+	if c.Storage == nil {
+		c.Storage = NewMemoryCacheStorage(0)
+	}
+	if c.HeuristicFraction <= 0 {
+		c.HeuristicFraction = 0.1
+	}
+	if c.MaxHeuristic <= 0 {
+		c.MaxHeuristic = 24 * time.Hour
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = 10 << 20
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = defaultCacheKey
+	}
+	if c.RefreshTimeout <= 0 {
+		c.RefreshTimeout = 30 * time.Second
+	}
+}
+
+// defaultCacheKey 带有凭据的请求按凭据区分缓存, 避免一个用户的 private 响应返回给另一个用户
+func defaultCacheKey(request *http.Request) string {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	key := method + " " + request.URL.String()
+	authorization := request.Header.Values("Authorization")
+	cookies := request.Header.Values("Cookie")
+	if len(authorization) == 0 && len(cookies) == 0 {
+		return key
+	}
+	hash := sha256.New()
+	hash.Write([]byte(strings.Join(authorization, "\n")))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(cookies, "\n")))
+	return key + " " + hex.EncodeToString(hash.Sum(nil))
+}
+
+// heuristicStatusCodes 默认可以缓存的状态码, RFC 9110 15.1
+var heuristicStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Cache 按 RFC 9111 缓存 GET/HEAD 响应, 过期后通过 If-None-Match/If-Modified-Since 向服务端验证
+type Cache struct {
+	config CacheConfig
+	now    func() time.Time
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+func NewCache(config CacheConfig) *Cache {
+	config.Default()
+	return &Cache{
+		config:     config,
+		now:        time.Now,
+		refreshing: make(map[string]bool),
+	}
+}
+
+// CacheMiddleware 创建响应缓存并返回其中间件
+func CacheMiddleware(config CacheConfig) dataflow.RequestMiddleware {
+	return NewCache(config).Middleware()
+}
+
+func (c *Cache) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			status := dataflow.CacheMiss
+			request = request.WithContext(dataflow.WithCacheStatus(request.Context(), &status))
+
+			method := request.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			if method != http.MethodGet && method != http.MethodHead {
+				err := handle(request, response)
+				if err == nil && response.StatusCode < http.StatusBadRequest && !isSafeMethod(method) {
+					c.invalidate(request)
+				}
+				return err
+			}
+
+			requestCC := parseCacheControl(request.Header)
+			// 调用方自己发起的条件请求与范围请求不使用缓存
+			if requestCC.has("no-store") || request.Header.Get("Range") != "" ||
+				request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != "" {
+				return handle(request, response)
+			}
+
+			key := c.config.KeyFunc(request)
+			entry := c.lookup(request, key)
+			now := c.now()
+			if entry != nil && c.usable(entry, requestCC, now) {
+				status = dataflow.CacheHit
+				*response = *c.response(entry, request, now)
+				return nil
+			}
+			if requestCC.has("only-if-cached") {
+				*response = *gatewayTimeout(request)
+				return nil
+			}
+			if entry != nil && !requestCC.has("no-cache") &&
+				c.canServeStale(entry, requestCC, now, "stale-while-revalidate", c.config.StaleWhileRevalidate) {
+				status = dataflow.CacheStale
+				*response = *c.response(entry, request, now)
+				// 在返回前复制请求, 调用方之后修改请求头不会影响后台请求
+				refreshRequest := request.Clone(detachedContext{parent: request.Context()})
+				go c.refresh(handle, refreshRequest, key, entry)
+				return nil
+			}
+
+			var err error
+			status, err = c.fetch(handle, request, requestCC, key, entry, response)
+			return err
+		}
+	}
+}
+
+// fetch 向服务端发送请求, 有缓存时发送条件请求, 并按响应更新缓存
+func (c *Cache) fetch(handle dataflow.RequestHandle, request *http.Request, requestCC cacheControl, key string, entry *CacheEntry, response *http.Response) (dataflow.CacheStatus, error) {
+	outgoing := request
+	if entry != nil {
+		outgoing = conditionalRequest(request, entry)
+	}
+	requestTime := c.now()
+	err := handle(outgoing, response)
+
+	// 服务端出错或返回 5xx 时使用过期的缓存
+	if entry != nil && (err != nil || isServerError(response.StatusCode)) &&
+		c.canServeStale(entry, requestCC, c.now(), "stale-if-error", c.config.StaleIfError) {
+		if err == nil {
+			discardResponseBody(response)
+		}
+		*response = *c.response(entry, request, c.now())
+		return dataflow.CacheStaleIfError, nil
+	}
+	if err != nil {
+		return dataflow.CacheMiss, err
+	}
+	responseTime := c.now()
+
+	if outgoing != request && response.StatusCode == http.StatusNotModified {
+		discardResponseBody(response)
+		updated := c.revalidated(entry, response, requestTime, responseTime)
+		c.store(key, updated)
+		*response = *c.response(updated, request, responseTime)
+		return dataflow.CacheRevalidated, nil
+	}
+
+	if c.storable(request, requestCC, response) {
+		c.save(key, request, response, requestTime, responseTime)
+	}
+	return dataflow.CacheMiss, nil
+}
+
+func isServerError(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// refresh 在后台验证过期的缓存, 同一个 key 同时只有一个后台请求, 不受原请求取消的影响, 超过 RefreshTimeout 时放弃
+func (c *Cache) refresh(handle dataflow.RequestHandle, request *http.Request, key string, entry *CacheEntry) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshing, key)
+		c.mu.Unlock()
+	}()
+
+	status := dataflow.CacheMiss
+	ctx, cancel := context.WithTimeout(dataflow.WithCacheStatus(request.Context(), &status), c.config.RefreshTimeout)
+	defer cancel()
+	response := new(http.Response)
+	if _, err := c.fetch(handle, request.WithContext(ctx), cacheControl{}, key, entry, response); err == nil {
+		discardResponseBody(response)
+	}
+}
+
+// canServeStale 按 directive 指令或 override 判断是否可以使用过期的缓存, must-revalidate 与 no-cache 禁止使用过期的缓存.
+// 只用于已经过期的缓存, 调用方通过 max-age 或 min-fresh 要求更新的缓存时不使用
+func (c *Cache) canServeStale(entry *CacheEntry, requestCC cacheControl, now time.Time, directive string, override time.Duration) bool {
+	responseCC := parseCacheControl(entry.Header)
+	if responseCC.has("must-revalidate") || responseCC.has("no-cache") ||
+		(c.config.Shared && responseCC.has("proxy-revalidate")) {
+		return false
+	}
+	if _, ok := requestCC.duration("max-age"); ok {
+		return false
+	}
+	if _, ok := requestCC.duration("min-fresh"); ok {
+		return false
+	}
+	window := override
+	if window <= 0 {
+		var ok bool
+		if window, ok = responseCC.duration(directive); !ok {
+			return false
+		}
+	}
+	staleness := c.currentAge(entry, now) - c.freshnessLifetime(entry)
+	return staleness > 0 && staleness <= window
+}
+
+// detachedContext 保留 parent 中的值, 但不继承其取消与超时
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// lookup 查找与请求 Vary 匹配的缓存, HEAD 请求可以使用 GET 请求的缓存
+func (c *Cache) lookup(request *http.Request, key string) *CacheEntry {
+	entry := c.get(key)
+	if entry == nil && request.Method == http.MethodHead {
+		getRequest := request.Clone(request.Context())
+		getRequest.Method = http.MethodGet
+		entry = c.get(c.config.KeyFunc(getRequest))
+	}
+	if entry == nil || !varyMatches(entry, request) {
+		return nil
+	}
+	return entry
+}
+
+func (c *Cache) get(key string) *CacheEntry {
+	entry, ok, err := c.config.Storage.Get(key)
+	if err != nil {
+		c.storageError(err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return entry
+}
+
+func (c *Cache) store(key string, entry *CacheEntry) {
+	if err := c.config.Storage.Set(key, entry); err != nil {
+		c.storageError(err)
+	}
+}
+
+func (c *Cache) storageError(err error) {
+	if c.config.OnStorageError != nil {
+		c.config.OnStorageError(err)
+	}
+}
+
+// invalidate 不安全方法成功后使对应 URL 的缓存失效, RFC 9111 4.4
+func (c *Cache) invalidate(request *http.Request) {
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		cacheRequest := request.Clone(request.Context())
+		cacheRequest.Method = method
+		if err := c.config.Storage.Delete(c.config.KeyFunc(cacheRequest)); err != nil {
+			c.storageError(err)
+		}
+	}
+}
+
+// usable 判断缓存是否可以不经验证直接使用
+func (c *Cache) usable(entry *CacheEntry, requestCC cacheControl, now time.Time) bool {
+	responseCC := parseCacheControl(entry.Header)
+	if responseCC.has("no-cache") || requestCC.has("no-cache") {
+		return false
+	}
+
+	age := c.currentAge(entry, now)
+	lifetime := c.freshnessLifetime(entry)
+	if maxAge, ok := requestCC.duration("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := requestCC.duration("min-fresh"); ok {
+		lifetime -= minFresh
+	}
+	if age < lifetime {
+		return true
+	}
+
+	// 调用方通过 max-stale 接受过期的缓存
+	if responseCC.has("must-revalidate") || (c.config.Shared && responseCC.has("proxy-revalidate")) {
+		return false
+	}
+	if value, ok := requestCC["max-stale"]; ok {
+		if value == "" {
+			return true
+		}
+		if maxStale, ok := requestCC.duration("max-stale"); ok && age-lifetime <= maxStale {
+			return true
+		}
+	}
+	return false
+}
+
+// freshnessLifetime RFC 9111 4.2.1
+func (c *Cache) freshnessLifetime(entry *CacheEntry) time.Duration {
+	responseCC := parseCacheControl(entry.Header)
+	if c.config.Shared {
+		if sMaxAge, ok := responseCC.duration("s-maxage"); ok {
+			return sMaxAge
+		}
+	}
+	if maxAge, ok := responseCC.duration("max-age"); ok {
+		return maxAge
+	}
+	date := responseDate(entry)
+	if expiresHeader := entry.Header.Get("Expires"); expiresHeader != "" {
+		// 无法解析的 Expires 视为已经过期
+		expires, err := http.ParseTime(expiresHeader)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if !heuristicStatusCodes[entry.StatusCode] && !responseCC.has("public") {
+		return 0
+	}
+	if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+		lifetime := time.Duration(float64(date.Sub(lastModified)) * c.config.HeuristicFraction)
+		if lifetime > c.config.MaxHeuristic {
+			lifetime = c.config.MaxHeuristic
+		}
+		return lifetime
+	}
+	return 0
+}
+
+// currentAge RFC 9111 4.2.3
+func (c *Cache) currentAge(entry *CacheEntry, now time.Time) time.Duration {
+	apparentAge := entry.ResponseTime.Sub(responseDate(entry))
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(entry.Header.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + entry.ResponseTime.Sub(entry.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(entry.ResponseTime)
+}
+
+func responseDate(entry *CacheEntry) time.Time {
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		return date
+	}
+	return entry.ResponseTime
+}
+
+// storable RFC 9111 3
+func (c *Cache) storable(request *http.Request, requestCC cacheControl, response *http.Response) bool {
+	if response.StatusCode < 200 || response.StatusCode == http.StatusPartialContent || response.StatusCode == http.StatusNotModified {
+		return false
+	}
+	responseCC := parseCacheControl(response.Header)
+	if responseCC.has("no-store") || requestCC.has("no-store") {
+		return false
+	}
+	if c.config.Shared {
+		if responseCC.has("private") {
+			return false
+		}
+		if request.Header.Get("Authorization") != "" &&
+			!responseCC.has("public") && !responseCC.has("must-revalidate") && !responseCC.has("s-maxage") {
+			return false
+		}
+	}
+	for _, field := range headerList(response.Header, "Vary") {
+		if field == "*" {
+			return false
+		}
+	}
+	if response.ContentLength > c.config.MaxBodySize {
+		return false
+	}
+	_, hasMaxAge := responseCC.duration("max-age")
+	_, hasSMaxAge := responseCC.duration("s-maxage")
+	return response.Header.Get("Expires") != "" || hasMaxAge || (c.config.Shared && hasSMaxAge) ||
+		responseCC.has("public") || heuristicStatusCodes[response.StatusCode]
+}
+
+// save 读取响应体保存到缓存, 超过 MaxBodySize 时放弃缓存, 调用方读取到的响应体保持不变
+func (c *Cache) save(key string, request *http.Request, response *http.Response, requestTime time.Time, responseTime time.Time) {
+	var body []byte
+	if response.Body != nil && response.Body != http.NoBody {
+		data, err := io.ReadAll(io.LimitReader(response.Body, c.config.MaxBodySize+1))
+		if err != nil || int64(len(data)) > c.config.MaxBodySize {
+			response.Body = &prefixBody{Reader: io.MultiReader(bytes.NewReader(data), response.Body), Closer: response.Body}
+			return
+		}
+		_ = response.Body.Close()
+		response.Body = io.NopCloser(bytes.NewReader(data))
+		body = data
+	}
+
+	entry := &CacheEntry{
+		StatusCode:   response.StatusCode,
+		Status:       response.Status,
+		Header:       response.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	if fields := headerList(response.Header, "Vary"); len(fields) > 0 {
+		entry.VaryHeaders = make(map[string]string, len(fields))
+		for _, field := range fields {
+			entry.VaryHeaders[http.CanonicalHeaderKey(field)] = strings.Join(request.Header.Values(field), ",")
+		}
+	}
+	c.store(key, entry)
+}
+
+// revalidated 服务端返回 304 后使用 304 中的响应头更新缓存, RFC 9111 4.3.4
+func (c *Cache) revalidated(entry *CacheEntry, notModified *http.Response, requestTime time.Time, responseTime time.Time) *CacheEntry {
+	updated := *entry
+	updated.Header = entry.Header.Clone()
+	for key, values := range notModified.Header {
+		if key == "Content-Length" {
+			continue
+		}
+		updated.Header[key] = append([]string(nil), values...)
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = responseTime
+	return &updated
+}
+
+// response 由缓存构造响应, 每次返回独立的响应体
+func (c *Cache) response(entry *CacheEntry, request *http.Request, now time.Time) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(c.currentAge(entry, now)/time.Second), 10))
+	status := entry.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode))
+	}
+	response := &http.Response{
+		Status:        status,
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(entry.Body)),
+		Request:       request,
+		Body:          http.NoBody,
+	}
+	if request.Method != http.MethodHead && len(entry.Body) > 0 {
+		response.Body = io.NopCloser(bytes.NewReader(entry.Body))
+	}
+	return response
+}
+
+func conditionalRequest(request *http.Request, entry *CacheEntry) *http.Request {
+	etag := entry.Header.Get("ETag")
+	lastModified := entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return request
+	}
+	conditional := request.Clone(request.Context())
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	return conditional
+}
+
+func varyMatches(entry *CacheEntry, request *http.Request) bool {
+	for field, value := range entry.VaryHeaders {
+		if strings.Join(request.Header.Values(field), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+func gatewayTimeout(request *http.Request) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout)),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    request,
+		Body:       http.NoBody,
+	}
+}
+
+// cacheControl Cache-Control 指令, 指令名为小写
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, directive := range headerList(header, "Cache-Control") {
+		name, value := directive, ""
+		if index := strings.IndexByte(directive, '='); index >= 0 {
+			name, value = directive[:index], strings.Trim(strings.TrimSpace(directive[index+1:]), `"`)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := cc[name]; !ok {
+			cc[name] = value
+		}
+	}
+	if len(cc) == 0 && strings.EqualFold(header.Get("Pragma"), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		// 无法解析的值按 0 处理, 即需要验证
+		return 0, true
+	}
+	// RFC 9111 1.2.2 过大的值按 2^31 秒处理
+	if seconds > 1<<31 {
+		seconds = 1 << 31
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// headerList 按逗号拆分请求头的值, 忽略引号中的逗号
+func headerList(header http.Header, key string) []string {
+	var items []string
+	for _, value := range header.Values(key) {
+		start, quoted := 0, false
+		for i := 0; i <= len(value); i++ {
+			if i < len(value) && value[i] == '"' {
+				quoted = !quoted
+			}
+			if i == len(value) || (value[i] == ',' && !quoted) {
+				if item := strings.TrimSpace(value[start:i]); item != "" {
+					items = append(items, item)
+				}
+				start = i + 1
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,186 @@
+package httphelper
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheEntry 缓存的响应, 存储实现之间共享同一个实例时不应修改
+type CacheEntry struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	// RequestTime ResponseTime 发出请求与收到响应的时间, 用于计算 Age
+	RequestTime  time.Time
+	ResponseTime time.Time
+	// VaryHeaders 响应 Vary 中列出的请求头在原始请求中的值
+	VaryHeaders map[string]string
+}
+
+func (e *CacheEntry) size() int64 {
+	size := int64(len(e.Body))
+	for key, values := range e.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// CacheStorage 缓存存储, 未找到时返回 nil, false, nil
+type CacheStorage interface {
+	Get(key string) (*CacheEntry, bool, error)
+	Set(key string, entry *CacheEntry) error
+	Delete(key string) error
+}
+
+// MemoryCacheStorage 按总大小淘汰最久未使用条目的内存缓存
+type MemoryCacheStorage struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+// NewMemoryCacheStorage maxBytes 为响应体与响应头的总大小上限, 小于等于 0 时为 64MB
+func NewMemoryCacheStorage(maxBytes int64) *MemoryCacheStorage {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &MemoryCacheStorage{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStorage) Get(key string) (*CacheEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true, nil
+}
+
+func (s *MemoryCacheStorage) Set(key string, entry *CacheEntry) error {
+	item := &memoryCacheItem{key: key, entry: entry, size: entry.size()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	// 超过总大小的条目不缓存
+	if item.size > s.maxBytes {
+		return nil
+	}
+	s.items[key] = s.lru.PushFront(item)
+	s.size += item.size
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	return nil
+}
+
+// Len 返回缓存条目数
+func (s *MemoryCacheStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryCacheStorage) remove(key string) {
+	element, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(element)
+	delete(s.items, key)
+	s.size -= element.Value.(*memoryCacheItem).size
+}
+
+// DiskCacheStorage 每个条目保存为目录下的一个 JSON 文件, 文件名为 key 的 SHA-256, 不限制总大小
+type DiskCacheStorage struct {
+	dir string
+}
+
+func NewDiskCacheStorage(dir string) (*DiskCacheStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "create cache dir failed")
+	}
+	return &DiskCacheStorage{dir: dir}, nil
+}
+
+func (s *DiskCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *DiskCacheStorage) Get(key string) (*CacheEntry, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrap(err, "read cache file failed")
+	}
+	entry := new(CacheEntry)
+	if err = json.Unmarshal(data, entry); err != nil {
+		return nil, false, errors.Wrap(err, "decode cache file failed")
+	}
+	return entry, true, nil
+}
+
+// Set 先写入临时文件再替换, 并发读取时不会读到写了一半的文件
+func (s *DiskCacheStorage) Set(key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "encode cache entry failed")
+	}
+	tmp, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create cache file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "write cache file failed")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "write cache file failed")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), s.path(key)), "replace cache file failed")
+}
+
+func (s *DiskCacheStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "delete cache file failed")
+	}
+	return nil
+}
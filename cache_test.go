@@ -0,0 +1,411 @@
+package httphelper
+
+import (
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// clockedCache 创建使用 clock 计时的缓存
+func clockedCache(config CacheConfig, clock *fakeClock) *Cache {
+	cache := NewCache(config)
+	cache.now = clock.Now
+	return cache
+}
+
+func newCacheTestHelper(t *testing.T, handler http.HandlerFunc, cache *Cache) (Helper, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(cache.Middleware())
+	return helper, &calls
+}
+
+func cachedGet(t *testing.T, helper Helper, uri string, headers ...string) (*http.Response, string) {
+	df := helper.Df().Uri(uri)
+	for i := 0; i+1 < len(headers); i += 2 {
+		df.Header(headers[i], headers[i+1])
+	}
+	res, err := df.Request()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+func TestCacheMiddleware_MaxAge(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("config"))
+	}, NewCache(CacheConfig{}))
+
+	res, body := cachedGet(t, helper, "/config")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "config", body)
+
+	res, body = cachedGet(t, helper, "/config")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "config", body)
+	assert.Equal(t, "0", res.Header.Get("Age"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// 请求中的 no-cache 强制向服务端验证
+	res, _ = cachedGet(t, helper, "/config", "Cache-Control", "no-cache")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_Revalidate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var conditional int32
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-Version", strconv.Itoa(int(atomic.LoadInt32(&conditional))))
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("metadata"))
+	}, clockedCache(CacheConfig{}, clock))
+
+	cachedGet(t, helper, "/metadata")
+	clock.Add(11 * time.Second)
+
+	res, body := cachedGet(t, helper, "/metadata")
+	assert.Equal(t, dataflow.CacheRevalidated, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "metadata", body)
+	// 使用 304 中的响应头更新缓存
+	assert.Equal(t, "0", res.Header.Get("X-Version"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conditional))
+
+	// 验证后重新计算新鲜期
+	res, _ = cachedGet(t, helper, "/metadata")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_Heuristic(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	lastModified := clock.now.Add(-10 * time.Hour).UTC().Format(http.TimeFormat)
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte("static"))
+	}, clockedCache(CacheConfig{}, clock))
+
+	cachedGet(t, helper, "/static")
+	// 启发式新鲜期为 10h 的 10%, 即 1h
+	clock.Add(50 * time.Minute)
+	res, _ := cachedGet(t, helper, "/static")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+
+	clock.Add(20 * time.Minute)
+	res, body := cachedGet(t, helper, "/static")
+	assert.Equal(t, dataflow.CacheRevalidated, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "static", body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_NotStored(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		_, _ = w.Write([]byte("body"))
+	}, NewCache(CacheConfig{Shared: true}))
+
+	for _, cc := range []string{"no-store", "private, max-age=60", "max-age=60"} {
+		for i := 0; i < 2; i++ {
+			cachedGet(t, helper, "/?cc="+url.QueryEscape(cc), "Authorization", "Bearer token")
+		}
+	}
+	// 共享缓存不保存 private 响应与带 Authorization 的请求
+	assert.Equal(t, int32(6), atomic.LoadInt32(calls))
+
+	cachedGet(t, helper, "/?cc=public,max-age=60", "Authorization", "Bearer token")
+	res, _ := cachedGet(t, helper, "/?cc=public,max-age=60", "Authorization", "Bearer token")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+}
+
+func TestCacheMiddleware_Vary(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}, NewCache(CacheConfig{}))
+
+	_, body := cachedGet(t, helper, "/", "Accept-Language", "en")
+	assert.Equal(t, "en", body)
+	res, body := cachedGet(t, helper, "/", "Accept-Language", "en")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "en", body)
+	res, body = cachedGet(t, helper, "/", "Accept-Language", "zh")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "zh", body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_Credentials(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		_, _ = w.Write([]byte(r.Header.Get("Authorization") + r.Header.Get("Cookie")))
+	}, NewCache(CacheConfig{}))
+
+	// 不同用户的 private 响应不会互相命中
+	_, body := cachedGet(t, helper, "/me", "Authorization", "Bearer alice")
+	assert.Equal(t, "Bearer alice", body)
+	_, body = cachedGet(t, helper, "/me", "Authorization", "Bearer bob")
+	assert.Equal(t, "Bearer bob", body)
+	_, body = cachedGet(t, helper, "/me", "Cookie", "session=carol")
+	assert.Equal(t, "session=carol", body)
+
+	res, body := cachedGet(t, helper, "/me", "Authorization", "Bearer alice")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "Bearer alice", body)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_Invalidate(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.Method))
+	}, NewCache(CacheConfig{}))
+
+	cachedGet(t, helper, "/users/1")
+	_, err := helper.Df().Method(http.MethodPut).Uri("/users/1").Request()
+	assert.NoError(t, err)
+	res, _ := cachedGet(t, helper, "/users/1")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	// HEAD 请求可以使用 GET 请求的缓存
+	res, err = helper.Df().Method(http.MethodHead).Uri("/users/1").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	body, _ := io.ReadAll(res.Body)
+	assert.Empty(t, body)
+}
+
+func TestCacheMiddleware_OnlyIfCached(t *testing.T) {
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {}, NewCache(CacheConfig{}))
+
+	res, _ := cachedGet(t, helper, "/", "Cache-Control", "only-if-cached")
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+	assert.Equal(t, int32(0), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_DiskStorage(t *testing.T) {
+	storage, err := NewDiskCacheStorage(t.TempDir())
+	assert.NoError(t, err)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("persisted"))
+	}
+
+	keyFunc := func(request *http.Request) string { return request.URL.Path }
+	helper, calls := newCacheTestHelper(t, handler, NewCache(CacheConfig{Storage: storage, KeyFunc: keyFunc}))
+	cachedGet(t, helper, "/")
+	res, body := cachedGet(t, helper, "/")
+	assert.Equal(t, dataflow.CacheHit, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "persisted", body)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	entry, ok, err := storage.Get("/")
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, "persisted", string(entry.Body))
+		assert.Equal(t, "max-age=60", entry.Header.Get("Cache-Control"))
+	}
+	assert.NoError(t, storage.Delete("missing"))
+}
+
+func TestMemoryCacheStorage_Evict(t *testing.T) {
+	storage := NewMemoryCacheStorage(10)
+	assert.NoError(t, storage.Set("a", &CacheEntry{Body: []byte("aaaa")}))
+	assert.NoError(t, storage.Set("b", &CacheEntry{Body: []byte("bbbb")}))
+	_, _, _ = storage.Get("a")
+	assert.NoError(t, storage.Set("c", &CacheEntry{Body: []byte("cccc")}))
+
+	_, ok, _ := storage.Get("b")
+	assert.False(t, ok)
+	_, ok, _ = storage.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, storage.Len())
+
+	assert.NoError(t, storage.Set("d", &CacheEntry{Body: []byte("too large entry")}))
+	_, ok, _ = storage.Get("d")
+	assert.False(t, ok)
+}
+
+func TestCacheMiddleware_StaleWhileRevalidate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var version int32
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&version, 1)))))
+	}, clockedCache(CacheConfig{}, clock))
+
+	_, body := cachedGet(t, helper, "/dashboard")
+	assert.Equal(t, "1", body)
+	clock.Add(5 * time.Second)
+
+	res, body := cachedGet(t, helper, "/dashboard")
+	assert.Equal(t, dataflow.CacheStale, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "1", body)
+	assert.Eventually(t, func() bool {
+		res, body = cachedGet(t, helper, "/dashboard")
+		return dataflow.ResponseCacheStatus(res) == dataflow.CacheHit && body == "2"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+	// 超过 stale-while-revalidate 的时长后同步请求
+	clock.Add(2 * time.Minute)
+	res, body = cachedGet(t, helper, "/dashboard")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "3", body)
+}
+
+func TestCacheMiddleware_StaleRequestMaxAge(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var version int32
+	helper, calls := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=60")
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&version, 1)))))
+	}, clockedCache(CacheConfig{}, clock))
+
+	cachedGet(t, helper, "/dashboard")
+	clock.Add(10 * time.Second)
+
+	// 缓存没有过期但不满足调用方的 max-age 与 min-fresh, 不能当作过期缓存返回
+	res, body := cachedGet(t, helper, "/dashboard", "Cache-Control", "max-age=5")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "2", body)
+	res, body = cachedGet(t, helper, "/dashboard", "Cache-Control", "min-fresh=65")
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "3", body)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestCacheMiddleware_RefreshTimeout(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var version int32
+	helper, _ := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&version, 1)
+		if n == 2 {
+			// 第一次后台验证一直没有响应
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(strconv.Itoa(int(n))))
+	}, clockedCache(CacheConfig{RefreshTimeout: 50 * time.Millisecond}, clock))
+
+	_, body := cachedGet(t, helper, "/dashboard")
+	assert.Equal(t, "1", body)
+	clock.Add(5 * time.Second)
+
+	// 超时后可以再次发起后台验证
+	assert.Eventually(t, func() bool {
+		res, body := cachedGet(t, helper, "/dashboard")
+		return dataflow.ResponseCacheStatus(res) == dataflow.CacheHit && body == "3"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCacheMiddleware_StaleIfError(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte("dashboard"))
+	}))
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(clockedCache(CacheConfig{}, clock).Middleware())
+
+	cachedGet(t, helper, "/")
+	clock.Add(5 * time.Second)
+	atomic.StoreInt32(&failing, 1)
+
+	res, body := cachedGet(t, helper, "/")
+	assert.Equal(t, dataflow.CacheStaleIfError, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "dashboard", body)
+
+	server.Close()
+	res, body = cachedGet(t, helper, "/")
+	assert.Equal(t, dataflow.CacheStaleIfError, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, "dashboard", body)
+
+	clock.Add(2 * time.Minute)
+	_, err := helper.Df().Uri("/").Request()
+	assert.Error(t, err)
+}
+
+func TestCacheMiddleware_StaleOverride(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var failing int32
+	helper, _ := newCacheTestHelper(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte("ok"))
+	}, clockedCache(CacheConfig{StaleIfError: time.Minute}, clock))
+
+	cachedGet(t, helper, "/?cc=max-age=1")
+	cachedGet(t, helper, "/?cc="+url.QueryEscape("max-age=1, must-revalidate"))
+	clock.Add(5 * time.Second)
+	atomic.StoreInt32(&failing, 1)
+
+	res, _ := cachedGet(t, helper, "/?cc=max-age=1")
+	assert.Equal(t, dataflow.CacheStaleIfError, dataflow.ResponseCacheStatus(res))
+	// must-revalidate 禁止使用过期的缓存
+	res, _ = cachedGet(t, helper, "/?cc="+url.QueryEscape("max-age=1, must-revalidate"))
+	assert.Equal(t, dataflow.CacheMiss, dataflow.ResponseCacheStatus(res))
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+}
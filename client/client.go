@@ -1,27 +1,204 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"time"
 )
 
 type Config struct {
+	// Timeout 请求整体超时(包含读取响应体), 0 或小于 0 表示不限制. Default 将 0 填充为 30s,
+	// nethttp.NewHttpClient 与 SetConfig 不会对传入的配置调用 Default, 只有 NewHttpClient(nil) 使用 30s
 	Timeout time.Duration
 	Cert    CertConfig
-	// 如果需要定制化tls, 设置该属性, 否则请使用Cert
-	// TlsConfig *tls.Config
+	// 如果需要定制化tls, 设置该属性, Cert 与 Tls 中的配置会在其副本上继续生效
+	TlsConfig *tls.Config
+	Tls       TlsOptions
+	// ProxyURL 所有请求使用的代理, 支持 http, https, socks5, socks5h
+	ProxyURL  string
+	Proxy     ProxyConfig
+	Transport TransportConfig
+	Resolver  ResolverConfig
+	SSRFGuard SSRFGuardConfig
+	Redirect  RedirectConfig
+	Cookie    CookieConfig
+}
+
+// RedirectConfig 重定向策略, 主机比较只比较主机名, 不包括端口
+type RedirectConfig struct {
+	// MaxRedirects 最大重定向次数, 默认 10, 超过时返回 nethttp.ErrTooManyRedirects
+	MaxRedirects int
+	// Disable 不跟随重定向, 直接返回 3xx 响应
+	Disable bool
+	// SameHostOnly 只允许重定向到与原始请求相同的主机
+	SameHostOnly bool
+	// AllowedHosts 允许重定向到的主机, 匹配规则与 ProxyRule.Hosts 相同, 为空表示不限制.
+	// 不允许的重定向返回 nethttp.ErrRedirectBlocked
+	AllowedHosts []string
+	// StripHeaders 重定向到其他主机时额外移除的请求头, 例如签名请求头.
+	// Authorization, Cookie 等敏感请求头在重定向到非子域名时总是会被移除
+	StripHeaders []string
+	// KeepHeaders 重定向到其他主机时仍然保留的敏感请求头, 例如 Authorization, 请配合 AllowedHosts 使用
+	KeepHeaders []string
+}
+
+func (c *RedirectConfig) Default() {
+	if c.MaxRedirects == 0 {
+		c.MaxRedirects = 10
+	}
+}
+
+// SSRFGuardConfig 在建立连接时(DNS 解析之后, 包括每一次重定向)检查目标 IP, 拒绝访问内网与云厂商元数据地址.
+// 使用代理(包括环境变量中的代理)时同时检查代理的地址与目标主机解析出的 IP, 内网代理需要加入 AllowCIDRs,
+// 此时目标主机由代理解析, 无法防止 DNS rebinding. 设置 TransportConfig.DialContext 或 UnixSocket 时不生效
+type SSRFGuardConfig struct {
+	// Enabled 开启后默认拒绝回环, 链路本地(包括 169.254.169.254), RFC1918 私有网段, 运营商 NAT, 组播与未指定地址
+	Enabled bool
+	// DenyCIDRs 额外拒绝的网段或 IP
+	DenyCIDRs []string
+	// AllowCIDRs 允许访问的网段或 IP, 优先于拒绝规则
+	AllowCIDRs []string
+}
+
+// ResolverConfig DNS 解析配置, 只对内置的拨号生效, 设置 TransportConfig.DialContext 或 UnixSocket 时不生效.
+// 解析只改变连接的地址, Host 请求头与 tls SNI 仍然使用 URL 中的主机名
+type ResolverConfig struct {
+	// Overrides 静态解析, key 为 host 或 host:port, 值为 IP 列表, 类似 curl --resolve
+	Overrides map[string][]string
+	// Server 自定义 DNS 服务器, 例如 10.0.0.2:53, 省略端口时使用 53
+	Server string
+	// CacheTTL 大于 0 时在进程内缓存解析结果
+	CacheTTL time.Duration
+	// NegativeTTL 大于 0 时缓存解析失败的结果
+	NegativeTTL time.Duration
+}
+
+// ProxyConfig 代理配置, 按 Rules, ProxyURL, 环境变量 HTTP_PROXY/HTTPS_PROXY/NO_PROXY 的顺序确定请求使用的代理
+type ProxyConfig struct {
+	// Username Password 代理认证信息, 设置后覆盖 ProxyURL 中的认证信息
+	Username string
+	Password string
+	// Rules 按主机匹配的代理规则, 第一条匹配的规则生效
+	Rules []ProxyRule
+	// IgnoreEnvironment 不读取代理环境变量
+	IgnoreEnvironment bool
+}
+
+// ProxyRule 主机到代理的映射规则
+type ProxyRule struct {
+	// Hosts 主机匹配模式, 支持 example.com, *.example.com(仅子域名), .example.com(域名及子域名), 10.0.0.0/8 与 *
+	Hosts []string
+	// ProxyURL 代理地址, 为空或 direct 表示直连
 	ProxyURL string
+	Username string
+	Password string
 }
 
+// CertConfig 客户端证书, 文件路径与内存中的 PEM 二选一, 同时设置时优先使用 PEM
 type CertConfig struct {
 	CertFile string
 	KeyFile  string
+	CertPEM  []byte
+	KeyPEM   []byte
+	// ReloadInterval 大于 0 时, 握手前按该间隔检查 CertFile 与 KeyFile 是否变化并重新加载, 不影响已建立的连接
+	ReloadInterval time.Duration
+	// Provider 自定义证书来源, 每次握手时调用, 设置后忽略以上证书配置
+	Provider func() (*tls.Certificate, error)
+	// OnReloadError 证书重新加载失败时回调, 失败时继续使用上一次加载成功的证书
+	OnReloadError func(err error)
+}
+
+// TlsOptions 常用的 tls 配置项
+type TlsOptions struct {
+	// RootCAFile 与 RootCAPEM 设置信任的根证书, 设置后不再使用系统根证书
+	RootCAFile string
+	RootCAPEM  []byte
+	// MinVersion MaxVersion 例如 tls.VersionTLS12
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+	// ServerName 覆盖用于证书校验与 SNI 的主机名
+	ServerName string
+	// InsecureSkipVerify 跳过服务端证书校验, 仅用于测试环境
+	InsecureSkipVerify bool
+	// Pins 按主机名配置的证书公钥(SPKI) SHA-256 指纹, 值为 base64 编码, 可带 sha256/ 前缀.
+	// 主机名按 SNI 匹配(IP 地址不发送 SNI, 可以配合 ServerName 使用), 支持 *.example.com 通配一级子域名,
+	// 同一主机配置多个指纹用于备份, 证书链中任一公钥匹配即通过
+	Pins map[string][]string
+}
+
+// TransportConfig 连接池与传输层配置, 0 值的字段在 Default 中填充默认值
+type TransportConfig struct {
+	// MaxIdleConns 所有主机的最大空闲连接数, 默认 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost 每个主机的最大空闲连接数, 默认 32
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost 每个主机的最大连接数, 0 表示不限制
+	MaxConnsPerHost int
+	// IdleConnTimeout 空闲连接的保留时间, 默认 90s
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout tls 握手超时, 默认 10s
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout 请求发送完成后等待响应头的超时, 0 表示不限制
+	ResponseHeaderTimeout time.Duration
+	// BodyIdleTimeout 读取响应体时超过该时长没有收到数据则中断, 0 表示不限制
+	BodyIdleTimeout time.Duration
+	// ExpectContinueTimeout 发送 Expect: 100-continue 后等待服务端响应的时间, 默认 1s
+	ExpectContinueTimeout time.Duration
+	// DialTimeout 建立 TCP 连接的超时, 默认 30s
+	DialTimeout time.Duration
+	// KeepAlive TCP keep-alive 探测间隔, 默认 30s, 小于 0 表示关闭
+	KeepAlive time.Duration
+	// UnixSocket 设置后所有请求都通过该 Unix socket 发送且不使用代理, URL 中的主机名只作为 Host 请求头,
+	// 例如 Url("http://unix/containers/json")
+	UnixSocket string
+	// DialContext 自定义建立连接的方法, 设置后 DialTimeout, KeepAlive 与 LocalAddr 需要自行处理
+	DialContext func(ctx context.Context, network string, addr string) (net.Conn, error)
+	// LocalAddr 建立连接时绑定的本地 IP
+	LocalAddr string
+	// LocalInterface 建立连接时绑定的网卡名称, 使用该网卡的第一个地址, 与 LocalAddr 同时设置时优先使用 LocalAddr
+	LocalInterface string
+	// DisableCompression 不自动请求 gzip 压缩
+	DisableCompression bool
+	// DisableHTTP2 不尝试使用 HTTP/2, 即 ForceAttemptHTTP2 为 false
+	DisableHTTP2 bool
+	// ReadBufferSize WriteBufferSize 连接读写缓冲区大小, 0 表示使用默认的 4KB
+	ReadBufferSize  int
+	WriteBufferSize int
+}
+
+func (c *TransportConfig) Default() {
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = 100
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = 32
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = 90 * time.Second
+	}
+	if c.TLSHandshakeTimeout == 0 {
+		c.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if c.ExpectContinueTimeout == 0 {
+		c.ExpectContinueTimeout = time.Second
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = 30 * time.Second
+	}
+	if c.KeepAlive == 0 {
+		c.KeepAlive = 30 * time.Second
+	}
 }
 
 func (c *Config) Default() {
 	if c.Timeout == 0 {
 		c.Timeout = time.Second * 30
 	}
+	c.Transport.Default()
+	c.Redirect.Default()
 }
 
 type Client interface {
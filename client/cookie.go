@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CookieConfig cookie 会话配置
+type CookieConfig struct {
+	// Enabled 使用内置的 cookie jar, 按公共后缀列表拒绝作用于 com, co.uk 等公共后缀的 cookie
+	Enabled bool
+	// Jar 自定义 cookie jar, 设置后忽略其他配置
+	Jar http.CookieJar
+	// Store 持久化存储, 设置后自动启用内置 cookie jar, 创建客户端时加载, 收到 Set-Cookie 时保存.
+	// 会话 cookie 同样会被保存
+	Store CookieStore
+	// OnStoreError 保存 cookie 失败时回调
+	OnStoreError func(err error)
+}
+
+// StoredCookie 持久化的 cookie, URL 为设置该 cookie 的请求地址, 用于恢复时确定作用域
+type StoredCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// CookieStore cookie 持久化存储, Save 每次保存全部 cookie
+type CookieStore interface {
+	Load() ([]StoredCookie, error)
+	Save(cookies []StoredCookie) error
+}
+
+// FileCookieStore 以 JSON 文件保存 cookie
+type FileCookieStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileCookieStore(path string) *FileCookieStore {
+	return &FileCookieStore{path: path}
+}
+
+// Load 文件不存在时返回空
+func (s *FileCookieStore) Load() ([]StoredCookie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read cookie file failed")
+	}
+	var cookies []StoredCookie
+	if err = json.Unmarshal(data, &cookies); err != nil {
+		return nil, errors.Wrap(err, "decode cookie file failed")
+	}
+	return cookies, nil
+}
+
+// Save 先写入临时文件再替换, 避免写入中断时损坏原文件
+func (s *FileCookieStore) Save(cookies []StoredCookie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode cookies failed")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create cookie file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "write cookie file failed")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "write cookie file failed")
+	}
+	if err = os.Chmod(tmp.Name(), 0600); err != nil {
+		return errors.Wrap(err, "write cookie file failed")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), s.path), "replace cookie file failed")
+}
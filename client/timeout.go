@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutPhase 超时发生的阶段
+type TimeoutPhase string
+
+const (
+	// TimeoutPhaseConnect 建立连接(包含 DNS 解析)超时, 对应 TransportConfig.DialTimeout
+	TimeoutPhaseConnect TimeoutPhase = "connect"
+	// TimeoutPhaseTLSHandshake tls 握手超时, 对应 TransportConfig.TLSHandshakeTimeout
+	TimeoutPhaseTLSHandshake TimeoutPhase = "tls_handshake"
+	// TimeoutPhaseResponseHeader 等待响应头超时, 对应 TransportConfig.ResponseHeaderTimeout
+	TimeoutPhaseResponseHeader TimeoutPhase = "response_header"
+	// TimeoutPhaseBodyIdle 读取响应体时超过该时长没有收到数据, 对应 TransportConfig.BodyIdleTimeout
+	TimeoutPhaseBodyIdle TimeoutPhase = "body_idle"
+	// TimeoutPhaseRequest 请求整体超时, 对应 Config.Timeout 或单个请求设置的超时
+	TimeoutPhaseRequest TimeoutPhase = "request"
+)
+
+// TimeoutError 请求超时错误, Phase 说明是哪个阶段的超时
+type TimeoutError struct {
+	Phase TimeoutPhase
+	// Duration 该阶段配置的超时时长
+	Duration time.Duration
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout (%s): %v", e.Phase, e.Duration, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout 实现 net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary 实现 net.Error
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+type requestTimeoutKey struct{}
+
+// WithRequestTimeout 为单个请求设置整体超时, 覆盖 Config.Timeout
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// RequestTimeoutFromContext 返回通过 WithRequestTimeout 设置的超时
+func RequestTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
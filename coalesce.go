@@ -0,0 +1,231 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/artisancloud/httphelper/dataflow"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CoalesceConfig struct {
+	// Methods 允许合并的请求方法, 默认 GET, HEAD, 其他方法需要请求体可以重放
+	Methods []string
+	// Headers 参与区分请求的请求头, 默认 Authorization, Cookie, Accept, Accept-Language
+	Headers []string
+	// MaxBodySize 共享响应体的最大字节数, 默认 10MB, 超过时响应只交给发起请求的调用方, 其他调用方各自发送请求
+	MaxBodySize int64
+	// Timeout 共享请求的超时, 包括读取响应体, 默认 30s, 与 http.Client.Timeout 一样对交给发起者的响应体同样生效
+	Timeout time.Duration
+}
+
+func (c *CoalesceConfig) Default() {
+	if len(c.Methods) == 0 {
+		c.Methods = []string{http.MethodGet, http.MethodHead}
+	}
+	if c.Headers == nil {
+		c.Headers = []string{"Authorization", "Cookie", "Accept", "Accept-Language"}
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = 10 << 20
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+}
+
+// Coalescer 合并并发的相同请求, 只有一个请求发送到服务端, 响应体读入内存后每个调用方得到独立的副本
+type Coalescer struct {
+	coalesced int64
+	config    CoalesceConfig
+	methods   map[string]bool
+
+	mu    sync.Mutex
+	calls map[string]*coalesceCall
+}
+
+type coalesceCall struct {
+	done     chan struct{}
+	response *http.Response
+	body     []byte
+	err      error
+	// oversized 响应体超过 MaxBodySize, 通过 handoff 交给发起者, 其他调用方需要自己发送请求
+	oversized  bool
+	handoff    chan *http.Response
+	leaderGone chan struct{}
+}
+
+func NewCoalescer(config CoalesceConfig) *Coalescer {
+	config.Default()
+	methods := make(map[string]bool, len(config.Methods))
+	for _, method := range config.Methods {
+		methods[strings.ToUpper(method)] = true
+	}
+	return &Coalescer{
+		config:  config,
+		methods: methods,
+		calls:   make(map[string]*coalesceCall),
+	}
+}
+
+// CoalesceMiddleware 创建请求合并器并返回其中间件
+func CoalesceMiddleware(config CoalesceConfig) dataflow.RequestMiddleware {
+	return NewCoalescer(config).Middleware()
+}
+
+// Coalesced 返回被合并(没有实际发送)的请求数
+func (c *Coalescer) Coalesced() int64 {
+	return atomic.LoadInt64(&c.coalesced)
+}
+
+func (c *Coalescer) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			key, ok := c.key(request)
+			if !ok {
+				return handle(request, response)
+			}
+
+			c.mu.Lock()
+			call, joined := c.calls[key]
+			if joined {
+				atomic.AddInt64(&c.coalesced, 1)
+			} else {
+				call = &coalesceCall{
+					done:       make(chan struct{}),
+					handoff:    make(chan *http.Response),
+					leaderGone: make(chan struct{}),
+				}
+				c.calls[key] = call
+				// 共享的请求不受发起者取消的影响, 每个调用方只受自己的 context 限制
+				go c.do(handle, request, key, call)
+			}
+			c.mu.Unlock()
+
+			var handoff chan *http.Response
+			if !joined {
+				handoff = call.handoff
+			}
+			select {
+			case <-call.done:
+			case leaderResponse := <-handoff:
+				*response = *leaderResponse
+				return nil
+			case <-request.Context().Done():
+				if !joined {
+					close(call.leaderGone)
+				}
+				return request.Context().Err()
+			}
+			if call.oversized {
+				return handle(request, response)
+			}
+			if call.err != nil {
+				return call.err
+			}
+			*response = *call.response
+			response.Header = call.response.Header.Clone()
+			response.Body = io.NopCloser(bytes.NewReader(call.body))
+			return nil
+		}
+	}
+}
+
+func (c *Coalescer) do(handle dataflow.RequestHandle, request *http.Request, key string, call *coalesceCall) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	// 响应体交给发起者时由发起者关闭响应体释放 context
+	ctx, cancel := context.WithTimeout(detachedContext{parent: request.Context()}, c.config.Timeout)
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			cancel()
+		}
+	}()
+
+	sharedRequest, err := rewindRequest(request.WithContext(ctx))
+	if err != nil {
+		call.err = err
+		return
+	}
+	response := new(http.Response)
+	if call.err = handle(sharedRequest, response); call.err != nil {
+		return
+	}
+	if response.Body != nil {
+		call.body, call.err = io.ReadAll(io.LimitReader(response.Body, c.config.MaxBodySize+1))
+		if call.err == nil && int64(len(call.body)) > c.config.MaxBodySize {
+			handedOff = true
+			response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+			c.handoff(response, call)
+			return
+		}
+		_ = response.Body.Close()
+	}
+	response.Body = nil
+	call.response = response
+}
+
+// handoff 响应体过大时不再合并, 把已读取的部分放回响应体交给发起者, 发起者已经离开时关闭响应
+func (c *Coalescer) handoff(response *http.Response, call *coalesceCall) {
+	call.oversized = true
+	response.Body = &prefixBody{Reader: io.MultiReader(bytes.NewReader(call.body), response.Body), Closer: response.Body}
+	call.body = nil
+	select {
+	case call.handoff <- response:
+	case <-call.leaderGone:
+		discardResponseBody(response)
+	}
+}
+
+// key 由方法, URL, 指定的请求头与请求体哈希组成, 不允许合并时返回 false
+func (c *Coalescer) key(request *http.Request) (string, bool) {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !c.methods[method] {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(method)
+	key.WriteString(" ")
+	key.WriteString(request.URL.String())
+	for _, header := range c.config.Headers {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(header))
+		key.WriteString(": ")
+		key.WriteString(strings.Join(request.Header.Values(header), ","))
+	}
+
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return "", false
+		}
+		body, err := request.GetBody()
+		if err != nil {
+			return "", false
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, body)
+		_ = body.Close()
+		if err != nil {
+			return "", false
+		}
+		key.WriteString("\n")
+		key.WriteString(hex.EncodeToString(hash.Sum(nil)))
+	}
+	return key.String(), true
+}
@@ -0,0 +1,194 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingServer 请求在 release 关闭后才返回, 返回服务端收到的请求数
+func newBlockingServer(t *testing.T, release chan struct{}) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("profile:" + r.Header.Get("Authorization") + string(body)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestCoalesceMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	server, calls := newBlockingServer(t, release)
+
+	coalescer := NewCoalescer(CoalesceConfig{})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(coalescer.Middleware())
+
+	const n = 10
+	bodies := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := helper.Df().Uri("/profile").Header("Authorization", "user-1").Request()
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(res.Body)
+				bodies[i] = string(body)
+			}
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return coalescer.Coalesced() == n-1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	for _, body := range bodies {
+		assert.Equal(t, "profile:user-1", body)
+	}
+}
+
+func TestCoalesceMiddleware_Key(t *testing.T) {
+	release := make(chan struct{})
+	server, calls := newBlockingServer(t, release)
+
+	coalescer := NewCoalescer(CoalesceConfig{Methods: []string{http.MethodGet, http.MethodPost}})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(coalescer.Middleware())
+
+	requests := []func() (*http.Response, error){
+		func() (*http.Response, error) { return helper.Df().Uri("/").Header("Authorization", "a").Request() },
+		func() (*http.Response, error) { return helper.Df().Uri("/").Header("Authorization", "b").Request() },
+		func() (*http.Response, error) {
+			return helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("x")).Request()
+		},
+		func() (*http.Response, error) {
+			return helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("x")).Request()
+		},
+		func() (*http.Response, error) {
+			return helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("y")).Request()
+		},
+		func() (*http.Response, error) { return helper.Df().Method(http.MethodPut).Uri("/").Request() },
+	}
+	var wg sync.WaitGroup
+	for _, request := range requests {
+		wg.Add(1)
+		go func(request func() (*http.Response, error)) {
+			defer wg.Done()
+			res, err := request()
+			if assert.NoError(t, err) {
+				_ = res.Body.Close()
+			}
+		}(request)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(calls) == 5 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// 只有请求体相同的两个 POST 请求被合并
+	assert.Equal(t, int32(5), atomic.LoadInt32(calls))
+	assert.Equal(t, int64(1), coalescer.Coalesced())
+}
+
+func TestCoalesceMiddleware_WaiterCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server, calls := newBlockingServer(t, release)
+
+	coalescer := NewCoalescer(CoalesceConfig{})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(coalescer.Middleware())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := helper.Df().WithContext(ctx).Uri("/").Request()
+		canceled <- err
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(calls) == 1 }, time.Second, time.Millisecond)
+
+	done := make(chan string, 1)
+	go func() {
+		res, err := helper.Df().Uri("/").Request()
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(res.Body)
+			done <- string(body)
+		}
+	}()
+	assert.Eventually(t, func() bool { return coalescer.Coalesced() == 1 }, time.Second, time.Millisecond)
+
+	// 发起者取消不影响其他等待的调用方
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+	close(release)
+	assert.Equal(t, "profile:", <-done)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestCoalesceMiddleware_MaxBodySize(t *testing.T) {
+	release := make(chan struct{})
+	server, calls := newBlockingServer(t, release)
+
+	coalescer := NewCoalescer(CoalesceConfig{MaxBodySize: 4})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(coalescer.Middleware())
+
+	const n = 3
+	bodies := make(chan string, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			res, err := helper.Df().Uri("/").Request()
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				bodies <- string(body)
+			}
+		}()
+	}
+	assert.Eventually(t, func() bool { return coalescer.Coalesced() == n-1 }, time.Second, time.Millisecond)
+	close(release)
+
+	// 响应体超过限制时只交给发起者, 其他调用方各自发送请求
+	for i := 0; i < n; i++ {
+		assert.Equal(t, "profile:", <-bodies)
+	}
+	assert.Equal(t, int32(n), atomic.LoadInt32(calls))
+}
+
+func TestCoalesceMiddleware_Timeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一个请求一直挂起直到客户端放弃
+		if atomic.AddInt32(&calls, 1) == 1 {
+			_, _ = io.ReadAll(r.Body)
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	coalescer := NewCoalescer(CoalesceConfig{Timeout: 50 * time.Millisecond})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(coalescer.Middleware())
+
+	_, err := helper.Df().Uri("/").Request()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// 超时后相同的请求不会继续等待挂起的共享请求
+	res, err := helper.Df().Uri("/").Request()
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "ok", string(body))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,34 @@
+package dataflow
+
+import (
+	"context"
+)
+
+// CacheStatus 响应的缓存状态, 由 httphelper.CacheMiddleware 设置
+type CacheStatus string
+
+const (
+	// CacheMiss 缓存未命中或不可缓存, 响应来自服务端
+	CacheMiss CacheStatus = "MISS"
+	// CacheHit 直接使用缓存的响应
+	CacheHit CacheStatus = "HIT"
+	// CacheRevalidated 缓存过期后向服务端验证, 服务端返回 304 后使用缓存的响应
+	CacheRevalidated CacheStatus = "REVALIDATED"
+	// CacheStale 返回过期的缓存并在后台验证(stale-while-revalidate)
+	CacheStale CacheStatus = "STALE"
+	// CacheStaleIfError 服务端出错时返回过期的缓存(stale-if-error)
+	CacheStaleIfError CacheStatus = "STALE_IF_ERROR"
+)
+
+type cacheStatusContextKey struct{}
+
+// WithCacheStatus 在 context 中放入用于接收 CacheStatus 的指针, ResponseCacheStatus 从响应对应请求的 context 中读取
+func WithCacheStatus(ctx context.Context, status *CacheStatus) context.Context {
+	return context.WithValue(ctx, cacheStatusContextKey{}, status)
+}
+
+// CacheStatusFromContext 返回通过 WithCacheStatus 放入的 CacheStatus
+func CacheStatusFromContext(ctx context.Context) (*CacheStatus, bool) {
+	status, ok := ctx.Value(cacheStatusContextKey{}).(*CacheStatus)
+	return status, ok
+}
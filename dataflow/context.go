@@ -0,0 +1,33 @@
+package dataflow
+
+import (
+	"context"
+	"net/http"
+)
+
+type routeContextKey struct{}
+
+// WithRoute 设置请求的路由模板, 例如 /users/{id}, 与 Dataflow.Route 相同
+func WithRoute(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, template)
+}
+
+// RouteFromContext 返回通过 WithRoute 或 Dataflow.Route 设置的路由模板
+func RouteFromContext(ctx context.Context) (string, bool) {
+	route, ok := ctx.Value(routeContextKey{}).(string)
+	return route, ok
+}
+
+type cookiesContextKey struct{}
+
+// WithCookies 为请求添加 cookie, 与 cookie jar 中的 cookie 一起发送, 多次调用时累加
+func WithCookies(ctx context.Context, cookies ...*http.Cookie) context.Context {
+	all := append(append([]*http.Cookie{}, CookiesFromContext(ctx)...), cookies...)
+	return context.WithValue(ctx, cookiesContextKey{}, all)
+}
+
+// CookiesFromContext 返回通过 WithCookies 添加的 cookie
+func CookiesFromContext(ctx context.Context) []*http.Cookie {
+	cookies, _ := ctx.Value(cookiesContextKey{}).([]*http.Cookie)
+	return cookies
+}
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type RequestHandle func(request *http.Request, response *http.Response) error
@@ -62,6 +63,13 @@ type ResponseHelper interface {
 	GetBodyJsonAsMap() (map[string]interface{}, error)
 }
 
+// Redirect 一次重定向, URL 为发出的请求地址, StatusCode 与 Location 为该请求收到的重定向响应
+type Redirect struct {
+	URL        *url.URL
+	StatusCode int
+	Location   string
+}
+
 type MultipartDataflow interface {
 	Boundary(b string) MultipartDataflow
 	FileByPath(fieldName string, filePath string) MultipartDataflow
@@ -81,6 +89,8 @@ type Dataflow struct {
 	middlewareHandle RequestMiddleware
 	request          *http.Request
 	option           *Option
+	route            string
+	timeout          time.Duration
 	err              []error
 }
 
@@ -168,6 +178,20 @@ func (d *Dataflow) Url(requestUrl string) RequestDataflow {
 	return d
 }
 
+// Route 设置请求的路由模板, 例如 /users/{id}, 供限流、监控等中间件按模板聚合而不是按实际路径.
+// 通过 RequestDataflow 接口时使用 WithContext(WithRoute(ctx, template))
+func (d *Dataflow) Route(template string) RequestDataflow {
+	d.route = template
+	return d
+}
+
+// Timeout 设置当前请求的整体超时, 覆盖 client.Config.Timeout, 重试时对每次尝试单独生效.
+// 通过 RequestDataflow 接口时使用 WithContext(client.WithRequestTimeout(ctx, timeout))
+func (d *Dataflow) Timeout(timeout time.Duration) RequestDataflow {
+	d.timeout = timeout
+	return d
+}
+
 func (d *Dataflow) makeHeaderIfNil() {
 	if d.request.Header == nil {
 		d.request.Header = make(http.Header)
@@ -190,6 +214,14 @@ func (d *Dataflow) Header(key string, values ...string) RequestDataflow {
 	return d
 }
 
+// Cookie 为当前请求添加 cookie, 与 cookie jar 中的 cookie 一起发送.
+// 通过 RequestDataflow 接口时使用 WithContext(WithCookies(ctx, cookies...))
+func (d *Dataflow) Cookie(name string, value string) RequestDataflow {
+	d.makeHeaderIfNil()
+	d.request.AddCookie(&http.Cookie{Name: name, Value: value})
+	return d
+}
+
 func (d *Dataflow) Query(key string, values ...string) RequestDataflow {
 	if len(values) == 0 {
 		return d
@@ -365,7 +397,7 @@ func (d *Dataflow) Request() (response *http.Response, err error) {
 	})
 
 	response = new(http.Response)
-	err = handle(d.request, response)
+	err = handle(d.buildRequest(), response)
 	if err != nil {
 		d.err = append(d.err, errors.Wrap(err, "request failed"))
 		return response, d.Err()
@@ -373,6 +405,30 @@ func (d *Dataflow) Request() (response *http.Response, err error) {
 	return response, nil
 }
 
+// buildRequest 将 Dataflow 上记录的附加信息写入请求 context, 并添加 WithCookies 设置的 cookie
+func (d *Dataflow) buildRequest() *http.Request {
+	ctx := d.request.Context()
+	if d.route != "" {
+		ctx = WithRoute(ctx, d.route)
+	}
+	if d.timeout > 0 {
+		ctx = client.WithRequestTimeout(ctx, d.timeout)
+	}
+	cookies := CookiesFromContext(ctx)
+	if ctx == d.request.Context() && len(cookies) == 0 {
+		return d.request
+	}
+	request := d.request.WithContext(ctx)
+	if len(cookies) > 0 {
+		// 复制请求头, 不修改 Dataflow 上的请求
+		request.Header = request.Header.Clone()
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+	}
+	return request
+}
+
 // Result 实现了 Json 解码
 func (d *Dataflow) Result(result interface{}) (err error) {
 	if result == nil {
@@ -437,6 +493,71 @@ func (r *Response) GetBodyJsonAsMap() (map[string]interface{}, error) {
 	return data, nil
 }
 
+// GetCacheStatus 返回 CacheMiddleware 设置的缓存状态, 见 ResponseCacheStatus
+func (r *Response) GetCacheStatus() CacheStatus {
+	return ResponseCacheStatus(r.res)
+}
+
+// GetTiming 返回 TraceMiddleware 记录的各阶段耗时, 见 ResponseTiming
+func (r *Response) GetTiming() *Timing {
+	return ResponseTiming(r.res)
+}
+
+// GetCookies 返回响应中 Set-Cookie 设置的 cookie
+func (r *Response) GetCookies() []*http.Cookie {
+	return r.res.Cookies()
+}
+
+// GetRedirects 返回到达最终响应前经过的每一次重定向, 见 RedirectChain
+func (r *Response) GetRedirects() []Redirect {
+	return RedirectChain(r.res)
+}
+
+// ResponseCacheStatus 返回 CacheMiddleware 设置的缓存状态, 未使用该中间件时返回空
+func ResponseCacheStatus(response *http.Response) CacheStatus {
+	if response == nil || response.Request == nil {
+		return ""
+	}
+	if status, ok := CacheStatusFromContext(response.Request.Context()); ok {
+		return *status
+	}
+	return ""
+}
+
+// ResponseTiming 返回 TraceMiddleware 记录的各阶段耗时, 未使用该中间件时返回 nil
+func ResponseTiming(response *http.Response) *Timing {
+	if response == nil || response.Request == nil {
+		return nil
+	}
+	timing, _ := TimingFromContext(response.Request.Context())
+	return timing
+}
+
+// RedirectChain 通过 response.Request.Response 回溯重定向链, 按发生顺序返回
+func RedirectChain(response *http.Response) []Redirect {
+	if response == nil || response.Request == nil {
+		return nil
+	}
+	var redirects []Redirect
+	for previous := response.Request.Response; previous != nil; {
+		redirect := Redirect{
+			StatusCode: previous.StatusCode,
+			Location:   previous.Header.Get("Location"),
+		}
+		if previous.Request == nil {
+			redirects = append(redirects, redirect)
+			break
+		}
+		redirect.URL = previous.Request.URL
+		redirects = append(redirects, redirect)
+		previous = previous.Request.Response
+	}
+	for i, j := 0, len(redirects)-1; i < j; i, j = i+1, j-1 {
+		redirects[i], redirects[j] = redirects[j], redirects[i]
+	}
+	return redirects
+}
+
 func (d *Dataflow) RequestResHelper() (response ResponseHelper, err error) {
 	resp, err := d.Request()
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"io"
 	"log"
 	http2 "net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -175,3 +176,86 @@ func TestBindQuery(t *testing.T) {
 	assert.Equal(t, "Jane Doe", query.Get("name"))
 	assert.Equal(t, "jane.doe@example.com", query.Get("email"))
 }
+
+func TestDataflow_Timeout(t *testing.T) {
+	df := InitBaseDataflow()
+
+	df.Timeout(time.Second)
+
+	timeout, ok := client.RequestTimeoutFromContext(df.buildRequest().Context())
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, timeout)
+}
+
+func TestDataflow_Route(t *testing.T) {
+	df := InitBaseDataflow()
+	df.Route("/users/{id}")
+	route, ok := RouteFromContext(df.buildRequest().Context())
+	assert.True(t, ok)
+	assert.Equal(t, "/users/{id}", route)
+
+	df = InitBaseDataflow()
+	df.WithContext(WithRoute(context.Background(), "/orders/{id}"))
+	route, ok = RouteFromContext(df.buildRequest().Context())
+	assert.True(t, ok)
+	assert.Equal(t, "/orders/{id}", route)
+}
+
+func TestRedirectChain(t *testing.T) {
+	server := httptest.NewServer(http2.HandlerFunc(func(w http2.ResponseWriter, r *http2.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http2.Redirect(w, r, "/b", http2.StatusFound)
+		case "/b":
+			http2.Redirect(w, r, "/c", http2.StatusMovedPermanently)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	c, err := nethttp.NewHttpClient(&client.Config{})
+	assert.NoError(t, err)
+	res, err := NewDataflow(c, nil, &Option{BaseUrl: server.URL}).Uri("/a").Request()
+	assert.NoError(t, err)
+
+	redirects := RedirectChain(res)
+	if assert.Len(t, redirects, 2) {
+		assert.Equal(t, "/a", redirects[0].URL.Path)
+		assert.Equal(t, http2.StatusFound, redirects[0].StatusCode)
+		assert.Equal(t, "/b", redirects[0].Location)
+		assert.Equal(t, "/b", redirects[1].URL.Path)
+		assert.Equal(t, http2.StatusMovedPermanently, redirects[1].StatusCode)
+	}
+	assert.Equal(t, http2.StatusOK, res.StatusCode)
+}
+
+func TestDataflow_Cookie(t *testing.T) {
+	server := httptest.NewServer(http2.HandlerFunc(func(w http2.ResponseWriter, r *http2.Request) {
+		cookie, err := r.Cookie("token")
+		if err == nil {
+			http2.SetCookie(w, &http2.Cookie{Name: "echo", Value: cookie.Value})
+		}
+	}))
+	defer server.Close()
+
+	c, err := nethttp.NewHttpClient(&client.Config{})
+	assert.NoError(t, err)
+	res, err := NewDataflow(c, nil, &Option{BaseUrl: server.URL}).Cookie("token", "abc").Uri("/").Request()
+	assert.NoError(t, err)
+
+	cookies := res.Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "echo", cookies[0].Name)
+		assert.Equal(t, "abc", cookies[0].Value)
+	}
+
+	// 通过 RequestDataflow 接口时使用 WithCookies
+	ctx := WithCookies(context.Background(), &http2.Cookie{Name: "token", Value: "def"})
+	res, err = NewDataflow(c, nil, &Option{BaseUrl: server.URL}).WithContext(ctx).Uri("/").Request()
+	assert.NoError(t, err)
+	cookies = res.Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "def", cookies[0].Value)
+	}
+}
@@ -0,0 +1,43 @@
+package dataflow
+
+import (
+	"context"
+	"time"
+)
+
+// Timing 请求各阶段耗时, 由 httphelper.TraceMiddleware 记录.
+// 发生重定向或重试时记录的是最后一次请求的连接信息, Total 为整个请求的耗时
+type Timing struct {
+	Start time.Time
+	// DNS 域名解析耗时, 使用 client.ResolverConfig 时解析在拨号中完成, 计入 Connect
+	DNS time.Duration
+	// Connect 建立 TCP 连接耗时
+	Connect time.Duration
+	// TLSHandshake tls 握手耗时
+	TLSHandshake time.Duration
+	// TimeToFirstByte 从请求开始到收到响应第一个字节的耗时
+	TimeToFirstByte time.Duration
+	// ServerProcessing 请求发送完成到收到响应第一个字节的耗时
+	ServerProcessing time.Duration
+	// Total 到收到响应头为止的总耗时, 不包含读取响应体
+	Total time.Duration
+	// ConnReused 是否复用了连接, 复用时 DNS, Connect 与 TLSHandshake 为 0
+	ConnReused bool
+	// ConnIdleTime 复用的连接此前的空闲时长
+	ConnIdleTime time.Duration
+	RemoteAddr   string
+	LocalAddr    string
+}
+
+type timingContextKey struct{}
+
+// WithTiming 在 context 中放入用于接收 Timing 的指针, ResponseTiming 从响应对应请求的 context 中读取
+func WithTiming(ctx context.Context, timing *Timing) context.Context {
+	return context.WithValue(ctx, timingContextKey{}, timing)
+}
+
+// TimingFromContext 返回通过 WithTiming 放入的 Timing
+func TimingFromContext(ctx context.Context) (*Timing, bool) {
+	timing, ok := ctx.Value(timingContextKey{}).(*Timing)
+	return timing, ok
+}
@@ -0,0 +1,110 @@
+package nethttp
+
+import (
+	"crypto/tls"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader 在握手时提供最新的客户端证书, 证书文件变化后自动重新加载
+type certReloader struct {
+	cert client.CertConfig
+	now  func() time.Time
+
+	mu        sync.Mutex
+	current   *tls.Certificate
+	certStat  fileStat
+	keyStat   fileStat
+	lastCheck time.Time
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func newCertReloader(cert client.CertConfig) (*certReloader, error) {
+	r := &certReloader{
+		cert: cert,
+		now:  time.Now,
+	}
+	if cert.Provider != nil {
+		return r, nil
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.lastCheck = r.now()
+	return r, nil
+}
+
+// reload 重新加载证书文件, 调用方需要持有锁或保证没有并发
+func (r *certReloader) reload() error {
+	certStat, err := statFile(r.cert.CertFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat certificate file")
+	}
+	keyStat, err := statFile(r.cert.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat key file")
+	}
+	if r.current != nil && certStat == r.certStat && keyStat == r.keyStat {
+		return nil
+	}
+
+	certPair, err := loadCertificate(r.cert)
+	if err != nil {
+		return err
+	}
+	r.current = &certPair
+	r.certStat = certStat
+	r.keyStat = keyStat
+	return nil
+}
+
+func (r *certReloader) reportError(err error) {
+	if r.cert.OnReloadError != nil {
+		r.cert.OnReloadError(err)
+	}
+}
+
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert.Provider != nil {
+		certPair, err := r.cert.Provider()
+		if err != nil || certPair == nil {
+			if err == nil {
+				err = errors.New("certificate provider returned nil certificate")
+			}
+			r.reportError(errors.Wrap(err, "failed to get certificate from provider"))
+			if r.current == nil {
+				// 没有可用证书时不发送证书, 由服务端决定是否拒绝
+				return &tls.Certificate{}, nil
+			}
+			return r.current, nil
+		}
+		r.current = certPair
+		return certPair, nil
+	}
+
+	if now := r.now(); now.Sub(r.lastCheck) >= r.cert.ReloadInterval {
+		r.lastCheck = now
+		if err := r.reload(); err != nil {
+			r.reportError(err)
+		}
+	}
+	return r.current, nil
+}
@@ -0,0 +1,122 @@
+package nethttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func generateCertPEM(t *testing.T, commonName string) (certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM
+}
+
+func writeCertFiles(t *testing.T, dir string, commonName string, modTime time.Time) (string, string) {
+	certPEM, keyPEM := generateCertPEM(t, commonName)
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func commonNameOf(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Minute)
+	certFile, keyFile := writeCertFiles(t, dir, "first", modTime)
+
+	var reloadErrors []error
+	reloader, err := newCertReloader(client.CertConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: time.Second,
+		OnReloadError: func(err error) {
+			reloadErrors = append(reloadErrors, err)
+		},
+	})
+	assert.NoError(t, err)
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	cert, err := reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonNameOf(t, cert))
+
+	// 文件轮换后, 未到检查间隔时仍使用旧证书
+	writeCertFiles(t, dir, "second", modTime.Add(time.Second))
+	cert, _ = reloader.GetClientCertificate(nil)
+	assert.Equal(t, "first", commonNameOf(t, cert))
+
+	now = now.Add(time.Second)
+	cert, _ = reloader.GetClientCertificate(nil)
+	assert.Equal(t, "second", commonNameOf(t, cert))
+
+	// 加载失败时回调并继续使用旧证书
+	assert.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	now = now.Add(time.Second)
+	cert, _ = reloader.GetClientCertificate(nil)
+	assert.Equal(t, "second", commonNameOf(t, cert))
+	assert.Len(t, reloadErrors, 1)
+}
+
+func TestCertReloader_Provider(t *testing.T) {
+	certPEM, keyPEM := generateCertPEM(t, "provided")
+	tlsConfig, err := newTlsConfig(client.Config{
+		Cert: client.CertConfig{
+			Provider: func() (*tls.Certificate, error) {
+				cert, err := tls.X509KeyPair(certPEM, keyPEM)
+				return &cert, err
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.GetClientCertificate)
+
+	cert, err := tlsConfig.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "provided", commonNameOf(t, cert))
+}
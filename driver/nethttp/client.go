@@ -1,17 +1,18 @@
 package nethttp
 
 import (
-	"crypto/tls"
+	"context"
 	"github.com/artisancloud/httphelper/client"
 	"github.com/pkg/errors"
 	"net/http"
-	"net/url"
+	"net/http/httptrace"
 )
 
 // Client 是 net/http 的封装
 type Client struct {
 	conf       *client.Config
 	coreClient *http.Client
+	resolver   *resolver
 }
 
 func NewHttpClient(config *client.Config) (*Client, error) {
@@ -19,29 +20,38 @@ func NewHttpClient(config *client.Config) (*Client, error) {
 		config = &client.Config{}
 		config.Default()
 	}
-
-	coreClient, err := newCoreClient(*config)
+	conf := withDefaults(*config)
+	coreClient, resolver, err := newCoreClient(conf)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
-		conf:       config,
+		conf:       &conf,
 		coreClient: coreClient,
+		resolver:   resolver,
 	}, nil
 }
 
-// SetConfig 配置客户端
+// withDefaults 只填充传输层与重定向的默认值, config 是副本, 不修改调用方的配置, Timeout 为 0 时仍然不限制
+func withDefaults(config client.Config) client.Config {
+	config.Transport.Default()
+	config.Redirect.Default()
+	return config
+}
+
+// SetConfig 配置客户端, 与 NewHttpClient 一样不会把为 0 的 Timeout 填充为默认值
 func (c *Client) SetConfig(config client.Config) error {
-	config.Default()
+	config = withDefaults(config)
 	c.conf = &config
 
-	coreClient, err := newCoreClient(config)
+	coreClient, resolver, err := newCoreClient(config)
 	if err != nil {
 		return errors.Wrap(err, "failed to create core client use new config")
 	}
 
 	c.coreClient = coreClient
+	c.resolver = resolver
 	return nil
 }
 
@@ -50,36 +60,89 @@ func (c *Client) GetConfig() client.Config {
 	return *c.conf
 }
 
+// ResolverStats 返回 DNS 解析统计, 未配置 client.ResolverConfig 时返回空统计
+func (c *Client) ResolverStats() ResolverStats {
+	if c.resolver == nil {
+		return ResolverStats{}
+	}
+	return c.resolver.stats()
+}
+
+// CookieJar 返回客户端使用的 cookie jar, 未启用 cookie 时返回 nil
+func (c *Client) CookieJar() http.CookieJar {
+	return c.coreClient.Jar
+}
+
 func (c *Client) DoRequest(request *http.Request) (response *http.Response, err error) {
-	return c.coreClient.Do(request)
+	coreClient := c.coreClient
+	if timeout, ok := client.RequestTimeoutFromContext(request.Context()); ok {
+		copied := *coreClient
+		copied.Timeout = timeout
+		coreClient = &copied
+	}
+
+	tracker := newTimeoutTracker(request.Context(), coreClient.Timeout, c.conf.Transport)
+	ctx, cancel := context.WithCancel(httptrace.WithClientTrace(request.Context(), tracker.clientTrace()))
+	response, err = coreClient.Do(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return response, tracker.wrapError(err)
+	}
+	response.Body = tracker.wrapBody(response.Body, cancel)
+	return response, nil
 }
 
-func newCoreClient(config client.Config) (*http.Client, error) {
+func newCoreClient(config client.Config) (*http.Client, *resolver, error) {
 	coreClient := http.Client{
 		Timeout: config.Timeout,
 	}
+	if config.Timeout < 0 {
+		coreClient.Timeout = 0
+	}
+
+	resolver, err := newResolver(config.Resolver, config.Transport.DialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	transport := http.DefaultTransport.(*http.Transport).Clone()
+	guard, err := newSSRFGuard(config.SSRFGuard)
+	if err != nil {
+		return nil, nil, err
+	}
+	dialer, err := newDialer(config, resolver, guard)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := newTransport(config.Transport, dialer)
 
-	if config.Cert.CertFile != "" && config.Cert.KeyFile != "" {
-		certPair, err := tls.LoadX509KeyPair(config.Cert.CertFile, config.Cert.KeyFile)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to load certificate")
-		}
-		transport.TLSClientConfig = &tls.Config{
-			Certificates: []tls.Certificate{certPair},
-		}
+	tlsConfig, err := newTlsConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
 	}
 
-	if config.ProxyURL != "" {
-		proxyURL, err := url.Parse(config.ProxyURL)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to parse proxy URL")
-		}
-		transport.Proxy = http.ProxyURL(proxyURL)
+	proxy, err := newProxyFunc(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport.Proxy = proxy
+	if guard != nil {
+		transport.Proxy = guard.guardProxy(proxy, resolver)
+	}
+	if config.Transport.UnixSocket != "" {
+		transport.Proxy = nil
 	}
 
 	coreClient.Transport = transport
+	coreClient.CheckRedirect = newRedirectPolicy(config.Redirect).check
+
+	jar, err := newCookieJar(config.Cookie)
+	if err != nil {
+		return nil, nil, err
+	}
+	coreClient.Jar = jar
 
-	return &coreClient, nil
+	return &coreClient, resolver, nil
 }
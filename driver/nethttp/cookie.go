@@ -0,0 +1,154 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newCookieJar 没有启用 cookie 时返回 nil
+func newCookieJar(config client.CookieConfig) (http.CookieJar, error) {
+	if config.Jar != nil {
+		return config.Jar, nil
+	}
+	if !config.Enabled && config.Store == nil {
+		return nil, nil
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	if config.Store == nil {
+		return jar, nil
+	}
+
+	p := &persistentJar{
+		jar:     jar,
+		store:   config.Store,
+		onError: config.OnStoreError,
+		now:     time.Now,
+		entries: make(map[string]client.StoredCookie),
+	}
+	if err = p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// persistentJar 在 cookiejar.Jar 之外记录收到的 cookie 并写入 CookieStore, 恢复时按原请求地址重新设置
+type persistentJar struct {
+	jar     *cookiejar.Jar
+	store   client.CookieStore
+	onError func(err error)
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]client.StoredCookie
+}
+
+func (p *persistentJar) load() error {
+	stored, err := p.store.Load()
+	if err != nil {
+		return errors.Wrap(err, "load cookies failed")
+	}
+	now := p.now()
+	for _, entry := range stored {
+		if entry.Cookie == nil || (!entry.Cookie.Expires.IsZero() && !entry.Cookie.Expires.After(now)) {
+			continue
+		}
+		u, err := url.Parse(entry.URL)
+		if err != nil {
+			continue
+		}
+		p.entries[cookieKey(u, entry.Cookie)] = entry
+		p.jar.SetCookies(u, []*http.Cookie{entry.Cookie})
+	}
+	return nil
+}
+
+func (p *persistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return p.jar.Cookies(u)
+}
+
+func (p *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	p.jar.SetCookies(u, cookies)
+
+	// 保存也在锁内进行, 避免并发时较旧的快照覆盖较新的快照
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	for _, cookie := range cookies {
+		if !cookieDomainAllowed(u, cookie) {
+			continue
+		}
+		key := cookieKey(u, cookie)
+		if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && !cookie.Expires.After(now)) {
+			delete(p.entries, key)
+			continue
+		}
+		stored := *cookie
+		// MaxAge 是相对时间, 转换为绝对的过期时间后保存
+		if stored.MaxAge > 0 {
+			stored.Expires = now.Add(time.Duration(stored.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+		stored.Raw = ""
+		stored.Unparsed = nil
+		p.entries[key] = client.StoredCookie{URL: origin.String(), Cookie: &stored}
+	}
+	snapshot := make([]client.StoredCookie, 0, len(p.entries))
+	for _, entry := range p.entries {
+		if entry.Cookie.Expires.IsZero() || entry.Cookie.Expires.After(now) {
+			snapshot = append(snapshot, entry)
+		}
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].URL != snapshot[j].URL {
+			return snapshot[i].URL < snapshot[j].URL
+		}
+		return snapshot[i].Cookie.Name < snapshot[j].Cookie.Name
+	})
+	if err := p.store.Save(snapshot); err != nil && p.onError != nil {
+		p.onError(errors.Wrap(err, "save cookies failed"))
+	}
+}
+
+// cookieDomainAllowed 与 cookiejar 一样拒绝作用于公共后缀或其他域名的 cookie, 避免保存不会生效的 cookie
+func cookieDomainAllowed(u *url.URL, cookie *http.Cookie) bool {
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	host := strings.ToLower(u.Hostname())
+	if domain == "" || domain == host {
+		return true
+	}
+	if !strings.HasSuffix(host, "."+domain) {
+		return false
+	}
+	_, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	return err == nil
+}
+
+// cookieKey 按 cookie 的作用域与名称去重, 与 cookiejar 的规则一致: 域名, 路径, 名称
+func cookieKey(u *url.URL, cookie *http.Cookie) string {
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	if domain == "" {
+		domain = strings.ToLower(u.Hostname())
+	}
+	cookiePath := cookie.Path
+	if cookiePath == "" || cookiePath[0] != '/' {
+		cookiePath = path.Dir(u.Path)
+		if u.Path == "" || u.Path[0] != '/' {
+			cookiePath = "/"
+		}
+	}
+	return domain + ";" + cookiePath + ";" + cookie.Name
+}
@@ -0,0 +1,143 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newCookieServer(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "suffix", Value: "x", Path: "/", Domain: "co.uk"})
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+		}
+		var names []string
+		for _, cookie := range r.Cookies() {
+			names = append(names, cookie.Name+"="+cookie.Value)
+		}
+		_, _ = w.Write([]byte(strings.Join(names, ",")))
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	return "http://portal.example.co.uk:" + port
+}
+
+func cookieClient(t *testing.T, cookie client.CookieConfig) *Client {
+	httpClient, err := NewHttpClient(&client.Config{
+		Cookie:   cookie,
+		Resolver: client.ResolverConfig{Overrides: map[string][]string{"portal.example.co.uk": {"127.0.0.1"}}},
+	})
+	assert.NoError(t, err)
+	return httpClient
+}
+
+func getBody(t *testing.T, httpClient *Client, url string) string {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	response, err := httpClient.DoRequest(request)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return string(body)
+}
+
+func TestClient_CookieJar(t *testing.T) {
+	base := newCookieServer(t)
+
+	httpClient := cookieClient(t, client.CookieConfig{})
+	assert.Nil(t, httpClient.CookieJar())
+	getBody(t, httpClient, base+"/login")
+	assert.Equal(t, "", getBody(t, httpClient, base+"/"))
+
+	httpClient = cookieClient(t, client.CookieConfig{Enabled: true})
+	getBody(t, httpClient, base+"/login")
+	// 作用于公共后缀 co.uk 的 cookie 被拒绝
+	assert.Equal(t, "session=s1", getBody(t, httpClient, base+"/"))
+	getBody(t, httpClient, base+"/logout")
+	assert.Equal(t, "", getBody(t, httpClient, base+"/"))
+}
+
+func TestClient_CookieStore(t *testing.T) {
+	base := newCookieServer(t)
+	store := client.NewFileCookieStore(filepath.Join(t.TempDir(), "cookies.json"))
+
+	httpClient := cookieClient(t, client.CookieConfig{Store: store})
+	getBody(t, httpClient, base+"/login")
+
+	stored, err := store.Load()
+	assert.NoError(t, err)
+	// 被拒绝的 cookie 不会保存
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, "session", stored[0].Cookie.Name)
+		assert.False(t, stored[0].Cookie.Expires.IsZero())
+	}
+
+	// 重新创建客户端后从文件恢复
+	httpClient = cookieClient(t, client.CookieConfig{Store: store})
+	assert.Equal(t, "session=s1", getBody(t, httpClient, base+"/"))
+
+	getBody(t, httpClient, base+"/logout")
+	stored, err = store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, stored, 0)
+	httpClient = cookieClient(t, client.CookieConfig{Store: store})
+	assert.Equal(t, "", getBody(t, httpClient, base+"/"))
+}
+
+// slowCookieStore 保存时让出调度, 放大并发保存的乱序
+type slowCookieStore struct {
+	mu    sync.Mutex
+	saved []client.StoredCookie
+}
+
+func (s *slowCookieStore) Load() ([]client.StoredCookie, error) {
+	return nil, nil
+}
+
+func (s *slowCookieStore) Save(cookies []client.StoredCookie) error {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	s.saved = cookies
+	s.mu.Unlock()
+	return nil
+}
+
+func TestPersistentJar_ConcurrentSave(t *testing.T) {
+	store := &slowCookieStore{}
+	jar, err := newCookieJar(client.CookieConfig{Store: store})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	u, _ := url.Parse("http://example.com/")
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jar.SetCookies(u, []*http.Cookie{{Name: "c" + strconv.Itoa(i), Value: "v"}})
+		}(i)
+	}
+	wg.Wait()
+
+	// 最后保存的快照包含所有 cookie
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Len(t, store.saved, n)
+}
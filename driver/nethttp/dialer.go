@@ -0,0 +1,116 @@
+package nethttp
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"net"
+)
+
+// dialer 按配置建立连接: Unix socket, 自定义 DialContext 或绑定本地地址的 TCP 连接
+type dialer struct {
+	netDialer  *net.Dialer
+	custom     func(ctx context.Context, network string, addr string) (net.Conn, error)
+	unixSocket string
+	resolver   *resolver
+}
+
+func newDialer(config client.Config, resolver *resolver, guard *ssrfGuard) (*dialer, error) {
+	transport := config.Transport
+	d := &dialer{
+		netDialer: &net.Dialer{
+			Timeout:   transport.DialTimeout,
+			KeepAlive: transport.KeepAlive,
+		},
+		custom:     transport.DialContext,
+		unixSocket: transport.UnixSocket,
+		resolver:   resolver,
+	}
+
+	if guard != nil {
+		d.netDialer.Control = guard.control
+	}
+
+	localIP, err := resolveLocalIP(transport.LocalAddr, transport.LocalInterface)
+	if err != nil {
+		return nil, err
+	}
+	if localIP != nil {
+		d.netDialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+	return d, nil
+}
+
+func (d *dialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if d.unixSocket != "" {
+		return d.netDialer.DialContext(ctx, "unix", d.unixSocket)
+	}
+	if d.custom != nil {
+		return d.custom(ctx, network, addr)
+	}
+	if d.resolver != nil {
+		return d.dialResolved(ctx, network, addr)
+	}
+	return d.netDialer.DialContext(ctx, network, addr)
+}
+
+// dialResolved 使用 resolver 解析地址后依次尝试连接每个 IP
+func (d *dialer) dialResolved(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := d.resolver.resolve(ctx, host, port)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	var firstErr error
+	for _, ip := range ips {
+		if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+			continue
+		}
+		conn, err := d.netDialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = &net.OpError{Op: "dial", Net: network, Err: errors.Errorf("no suitable address found for %q", host)}
+	}
+	return nil, firstErr
+}
+
+func resolveLocalIP(localAddr string, localInterface string) (net.IP, error) {
+	if localAddr != "" {
+		ip := net.ParseIP(localAddr)
+		if ip == nil {
+			return nil, errors.Errorf("invalid local address %q", localAddr)
+		}
+		return ip, nil
+	}
+	if localInterface == "" {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(localInterface)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find interface %q", localInterface)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get addresses of interface %q", localInterface)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, errors.Errorf("interface %q has no address", localInterface)
+}
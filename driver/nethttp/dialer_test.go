@@ -0,0 +1,90 @@
+package nethttp
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestClient_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix socket is not supported:", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + r.URL.Path))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	// SSRF 防护不作用于 Unix socket
+	httpClient, err := NewHttpClient(&client.Config{
+		ProxyURL:  "http://proxy.invalid:3128",
+		Transport: client.TransportConfig{UnixSocket: socket},
+		SSRFGuard: client.SSRFGuardConfig{Enabled: true},
+	})
+	assert.NoError(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, "http://unix/containers/json", nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.Equal(t, "unix/containers/json", string(body))
+	}
+}
+
+func TestClient_DialContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var dialed string
+	httpClient, err := NewHttpClient(&client.Config{
+		Transport: client.TransportConfig{
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				dialed = addr
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, "http://sidecar.local:8080/", nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		_ = response.Body.Close()
+	}
+	assert.Equal(t, "sidecar.local:8080", dialed)
+}
+
+func TestClient_LocalAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		_, _ = w.Write([]byte(host))
+	}))
+	defer server.Close()
+
+	httpClient, err := NewHttpClient(&client.Config{
+		Transport: client.TransportConfig{LocalAddr: "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.Equal(t, "127.0.0.1", string(body))
+	}
+
+	_, err = NewHttpClient(&client.Config{Transport: client.TransportConfig{LocalAddr: "invalid"}})
+	assert.Error(t, err)
+}
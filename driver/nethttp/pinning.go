@@ -0,0 +1,89 @@
+package nethttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrPinMismatch 服务端证书公钥与配置的指纹不匹配, 可以通过 errors.Is 判断
+var ErrPinMismatch = errors.New("certificate public key pin mismatch")
+
+// PinMismatchError 公钥指纹校验失败, Presented 为服务端证书链中每张证书的 SPKI 指纹
+type PinMismatchError struct {
+	Host      string
+	Presented []string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate public key pin mismatch for %q, presented chain: %s", e.Host, strings.Join(e.Presented, ", "))
+}
+
+func (e *PinMismatchError) Is(target error) bool {
+	return target == ErrPinMismatch
+}
+
+// SPKIPin 计算证书公钥的 SHA-256 指纹, 格式为 sha256/<base64>
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func normalizePin(pin string) string {
+	return "sha256/" + strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+}
+
+// newPinVerifier 返回校验公钥指纹的 VerifyConnection, next 为原有的 VerifyConnection
+func newPinVerifier(pins map[string][]string, next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	hostPins := make(map[string]map[string]struct{}, len(pins))
+	for host, values := range pins {
+		set := make(map[string]struct{}, len(values))
+		for _, pin := range values {
+			set[normalizePin(pin)] = struct{}{}
+		}
+		hostPins[strings.ToLower(host)] = set
+	}
+
+	return func(state tls.ConnectionState) error {
+		if next != nil {
+			if err := next(state); err != nil {
+				return err
+			}
+		}
+
+		host := strings.ToLower(state.ServerName)
+		expected, ok := hostPins[host]
+		if !ok {
+			if i := strings.Index(host, "."); i >= 0 {
+				expected, ok = hostPins["*"+host[i:]]
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		// 只匹配经过验证的证书链, 服务端附带的其他证书不可信; 跳过验证时只匹配叶子证书
+		var certs []*x509.Certificate
+		for _, chain := range state.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(state.VerifiedChains) == 0 && len(state.PeerCertificates) > 0 {
+			certs = state.PeerCertificates[:1]
+		}
+		for _, cert := range certs {
+			if _, matched := expected[SPKIPin(cert)]; matched {
+				return nil
+			}
+		}
+
+		presented := make([]string, 0, len(state.PeerCertificates))
+		for _, cert := range state.PeerCertificates {
+			presented = append(presented, SPKIPin(cert))
+		}
+		return &PinMismatchError{Host: host, Presented: presented}
+	}
+}
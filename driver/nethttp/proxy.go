@@ -0,0 +1,105 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type proxyRule struct {
+	matchers []hostMatcher
+	// proxyURL 为 nil 表示直连
+	proxyURL *url.URL
+}
+
+// newProxyFunc 根据配置构建 http.Transport.Proxy
+func newProxyFunc(config client.Config) (func(*http.Request) (*url.URL, error), error) {
+	rules := make([]proxyRule, 0, len(config.Proxy.Rules))
+	for _, rule := range config.Proxy.Rules {
+		proxyURL, err := parseProxyURL(rule.ProxyURL, rule.Username, rule.Password)
+		if err != nil {
+			return nil, err
+		}
+		matchers := make([]hostMatcher, 0, len(rule.Hosts))
+		for _, pattern := range rule.Hosts {
+			matchers = append(matchers, newHostMatcher(pattern))
+		}
+		rules = append(rules, proxyRule{matchers: matchers, proxyURL: proxyURL})
+	}
+
+	defaultProxy, err := parseProxyURL(config.ProxyURL, config.Proxy.Username, config.Proxy.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(request *http.Request) (*url.URL, error) {
+		host := strings.ToLower(request.URL.Hostname())
+		for _, rule := range rules {
+			for _, matcher := range rule.matchers {
+				if matcher.match(host) {
+					return rule.proxyURL, nil
+				}
+			}
+		}
+		if defaultProxy != nil {
+			return defaultProxy, nil
+		}
+		if config.Proxy.IgnoreEnvironment {
+			return nil, nil
+		}
+		return http.ProxyFromEnvironment(request)
+	}, nil
+}
+
+func parseProxyURL(rawURL string, username string, password string) (*url.URL, error) {
+	if rawURL == "" || strings.EqualFold(rawURL, "direct") {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse proxy URL")
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if username != "" {
+		proxyURL.User = url.UserPassword(username, password)
+	}
+	return proxyURL, nil
+}
+
+// hostMatcher 主机匹配规则
+type hostMatcher struct {
+	pattern string
+	network *net.IPNet
+}
+
+func newHostMatcher(pattern string) hostMatcher {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return hostMatcher{network: network}
+	}
+	return hostMatcher{pattern: pattern}
+}
+
+func (m hostMatcher) match(host string) bool {
+	if m.network != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && m.network.Contains(ip)
+	}
+	switch {
+	case m.pattern == "*":
+		return true
+	case strings.HasPrefix(m.pattern, "*."):
+		return strings.HasSuffix(host, m.pattern[1:])
+	case strings.HasPrefix(m.pattern, "."):
+		return host == m.pattern[1:] || strings.HasSuffix(host, m.pattern)
+	default:
+		return host == m.pattern
+	}
+}
@@ -0,0 +1,92 @@
+package nethttp
+
+import (
+	"fmt"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrTooManyRedirects 重定向次数超过 RedirectConfig.MaxRedirects
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrRedirectBlocked 重定向的目标主机不被 RedirectConfig 允许
+	ErrRedirectBlocked = errors.New("redirect is blocked")
+)
+
+// RedirectError 重定向被拒绝, 可以通过 errors.Is 与 ErrTooManyRedirects 或 ErrRedirectBlocked 比较
+type RedirectError struct {
+	// Location 被拒绝的重定向地址
+	Location string
+	// Redirects 已经发生的重定向次数
+	Redirects int
+	TooMany   bool
+}
+
+func (e *RedirectError) Error() string {
+	if e.TooMany {
+		return fmt.Sprintf("stopped after %d redirects", e.Redirects)
+	}
+	return fmt.Sprintf("redirect to %s is blocked", e.Location)
+}
+
+func (e *RedirectError) Is(target error) bool {
+	if e.TooMany {
+		return target == ErrTooManyRedirects
+	}
+	return target == ErrRedirectBlocked
+}
+
+type redirectPolicy struct {
+	config  client.RedirectConfig
+	allowed []hostMatcher
+}
+
+func newRedirectPolicy(config client.RedirectConfig) *redirectPolicy {
+	p := &redirectPolicy{config: config}
+	for _, pattern := range config.AllowedHosts {
+		p.allowed = append(p.allowed, newHostMatcher(pattern))
+	}
+	return p
+}
+
+// check 实现 http.Client.CheckRedirect, 调用时 request 已经从原始请求复制了请求头
+func (p *redirectPolicy) check(request *http.Request, via []*http.Request) error {
+	if p.config.Disable {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > p.config.MaxRedirects {
+		return &RedirectError{Location: request.URL.String(), Redirects: len(via) - 1, TooMany: true}
+	}
+
+	origin := strings.ToLower(via[0].URL.Hostname())
+	host := strings.ToLower(request.URL.Hostname())
+	if p.config.SameHostOnly && host != origin {
+		return &RedirectError{Location: request.URL.String(), Redirects: len(via) - 1}
+	}
+	if len(p.allowed) > 0 && host != origin && !p.isAllowed(host) {
+		return &RedirectError{Location: request.URL.String(), Redirects: len(via) - 1}
+	}
+
+	if host != origin {
+		for _, key := range p.config.StripHeaders {
+			request.Header.Del(key)
+		}
+		for _, key := range p.config.KeepHeaders {
+			if values := via[0].Header.Values(key); len(values) > 0 && request.Header.Get(key) == "" {
+				request.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *redirectPolicy) isAllowed(host string) bool {
+	for _, matcher := range p.allowed {
+		if matcher.match(host) {
+			return true
+		}
+	}
+	return false
+}
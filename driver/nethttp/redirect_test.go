@@ -0,0 +1,109 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/to/"):
+			// /to/<host>/<path> 重定向到同一端口上的另一个主机名
+			parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/to/"), "/", 2)
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://"+net.JoinHostPort(parts[0], port)+"/"+parts[1], http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/loop"):
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte(r.Host + "|" + r.Header.Get("Authorization") + "|" + r.Header.Get("X-Signature")))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func redirectClient(t *testing.T, config client.RedirectConfig) *Client {
+	httpClient, err := NewHttpClient(&client.Config{
+		Redirect: config,
+		Resolver: client.ResolverConfig{Overrides: map[string][]string{
+			"a.example": {"127.0.0.1"},
+			"b.example": {"127.0.0.1"},
+		}},
+	})
+	assert.NoError(t, err)
+	return httpClient
+}
+
+func TestClient_RedirectLimit(t *testing.T) {
+	server := newRedirectServer(t)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/loop", nil)
+	_, err := redirectClient(t, client.RedirectConfig{MaxRedirects: 3}).DoRequest(request)
+	assert.True(t, errors.Is(err, ErrTooManyRedirects))
+	var redirectErr *RedirectError
+	if assert.True(t, errors.As(err, &redirectErr)) {
+		assert.Equal(t, 3, redirectErr.Redirects)
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, server.URL+"/loop", nil)
+	response, err := redirectClient(t, client.RedirectConfig{Disable: true}).DoRequest(request)
+	if assert.NoError(t, err) {
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusFound, response.StatusCode)
+		assert.Equal(t, "/loop", response.Header.Get("Location"))
+	}
+}
+
+func TestClient_RedirectHosts(t *testing.T) {
+	server := newRedirectServer(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	origin := "http://a.example:" + port
+
+	request, _ := http.NewRequest(http.MethodGet, origin+"/to/b.example/ok", nil)
+	_, err := redirectClient(t, client.RedirectConfig{SameHostOnly: true}).DoRequest(request)
+	assert.True(t, errors.Is(err, ErrRedirectBlocked))
+
+	request, _ = http.NewRequest(http.MethodGet, origin+"/to/b.example/ok", nil)
+	_, err = redirectClient(t, client.RedirectConfig{AllowedHosts: []string{"c.example"}}).DoRequest(request)
+	assert.True(t, errors.Is(err, ErrRedirectBlocked))
+
+	// 同一主机的重定向不受 AllowedHosts 限制
+	request, _ = http.NewRequest(http.MethodGet, origin+"/to/a.example/ok", nil)
+	response, err := redirectClient(t, client.RedirectConfig{SameHostOnly: true, AllowedHosts: []string{"c.example"}}).DoRequest(request)
+	if assert.NoError(t, err) {
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+}
+
+func TestClient_RedirectHeaders(t *testing.T) {
+	server := newRedirectServer(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	origin := "http://a.example:" + port
+
+	do := func(config client.RedirectConfig) string {
+		request, _ := http.NewRequest(http.MethodGet, origin+"/to/b.example/ok", nil)
+		request.Header.Set("Authorization", "Bearer token")
+		request.Header.Set("X-Signature", "sig")
+		response, err := redirectClient(t, config).DoRequest(request)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer response.Body.Close()
+		buf := new(strings.Builder)
+		_, _ = io.Copy(buf, response.Body)
+		return buf.String()
+	}
+
+	assert.Equal(t, "b.example:"+port+"||sig", do(client.RedirectConfig{}))
+	assert.Equal(t, "b.example:"+port+"||", do(client.RedirectConfig{StripHeaders: []string{"x-signature"}}))
+	assert.Equal(t, "b.example:"+port+"|Bearer token|sig", do(client.RedirectConfig{KeepHeaders: []string{"Authorization"}}))
+}
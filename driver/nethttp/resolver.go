@@ -0,0 +1,201 @@
+package nethttp
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResolverStats DNS 解析统计
+type ResolverStats struct {
+	// Lookups 需要解析的次数(不包含 IP 地址与静态解析)
+	Lookups int64
+	// Hits 命中缓存的次数
+	Hits int64
+	// NegativeHits 命中失败缓存的次数
+	NegativeHits int64
+	// Overrides 命中静态解析的次数
+	Overrides int64
+	// Errors 实际发起解析且失败的次数
+	Errors int64
+	// Entries 当前缓存条目数
+	Entries int64
+}
+
+type resolverEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+type resolverCall struct {
+	done chan struct{}
+	ips  []net.IP
+	err  error
+}
+
+// resolver 提供静态解析, 自定义 DNS 服务器与带 TTL 的解析缓存
+type resolver struct {
+	lookups, hits, negativeHits, overrideHits, errs int64
+
+	config    client.ResolverConfig
+	overrides map[string][]net.IP
+	lookup    func(ctx context.Context, host string) ([]net.IP, error)
+	now       func() time.Time
+
+	mu       sync.Mutex
+	cache    map[string]resolverEntry
+	inflight map[string]*resolverCall
+}
+
+// newResolver 没有任何解析配置时返回 nil
+func newResolver(config client.ResolverConfig, dialTimeout time.Duration) (*resolver, error) {
+	if len(config.Overrides) == 0 && config.Server == "" && config.CacheTTL <= 0 && config.NegativeTTL <= 0 {
+		return nil, nil
+	}
+
+	r := &resolver{
+		config:    config,
+		overrides: make(map[string][]net.IP, len(config.Overrides)),
+		now:       time.Now,
+		cache:     make(map[string]resolverEntry),
+		inflight:  make(map[string]*resolverCall),
+	}
+	for host, values := range config.Overrides {
+		ips := make([]net.IP, 0, len(values))
+		for _, value := range values {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, errors.Errorf("invalid override address %q for %q", value, host)
+			}
+			ips = append(ips, ip)
+		}
+		r.overrides[strings.ToLower(host)] = ips
+	}
+
+	netResolver := net.DefaultResolver
+	if config.Server != "" {
+		server := config.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		dnsDialer := &net.Dialer{Timeout: dialTimeout}
+		netResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				return dnsDialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	r.lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+		return netResolver.LookupIP(ctx, "ip", host)
+	}
+	return r, nil
+}
+
+// resolve 返回 host 对应的 IP 列表, port 用于匹配 host:port 形式的静态解析
+func (r *resolver) resolve(ctx context.Context, host string, port string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	host = strings.ToLower(host)
+	if ips, ok := r.overrides[net.JoinHostPort(host, port)]; ok {
+		atomic.AddInt64(&r.overrideHits, 1)
+		return ips, nil
+	}
+	if ips, ok := r.overrides[host]; ok {
+		atomic.AddInt64(&r.overrideHits, 1)
+		return ips, nil
+	}
+
+	atomic.AddInt64(&r.lookups, 1)
+	if r.config.CacheTTL <= 0 && r.config.NegativeTTL <= 0 {
+		return r.doLookup(ctx, host)
+	}
+
+	r.mu.Lock()
+	if entry, ok := r.cache[host]; ok && r.now().Before(entry.expires) {
+		r.mu.Unlock()
+		if entry.err != nil {
+			atomic.AddInt64(&r.negativeHits, 1)
+		} else {
+			atomic.AddInt64(&r.hits, 1)
+		}
+		return entry.ips, entry.err
+	}
+	// 同一主机同时只发起一次解析
+	if call, ok := r.inflight[host]; ok {
+		r.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.ips, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &resolverCall{done: make(chan struct{})}
+	r.inflight[host] = call
+	r.mu.Unlock()
+
+	// 解析结果会被其他请求共享, 不受当前请求取消的影响
+	call.ips, call.err = r.doLookup(context.Background(), host)
+
+	r.mu.Lock()
+	delete(r.inflight, host)
+	r.purgeExpired()
+	if call.err == nil && r.config.CacheTTL > 0 {
+		r.cache[host] = resolverEntry{ips: call.ips, expires: r.now().Add(r.config.CacheTTL)}
+	} else if call.err != nil && r.config.NegativeTTL > 0 {
+		r.cache[host] = resolverEntry{err: call.err, expires: r.now().Add(r.config.NegativeTTL)}
+	} else {
+		delete(r.cache, host)
+	}
+	r.mu.Unlock()
+	close(call.done)
+
+	return call.ips, call.err
+}
+
+// purgeExpired 缓存条目较多时清理过期条目, 调用方需要持有锁
+func (r *resolver) purgeExpired() {
+	if len(r.cache) < 1024 {
+		return
+	}
+	now := r.now()
+	for host, entry := range r.cache {
+		if !now.Before(entry.expires) {
+			delete(r.cache, host)
+		}
+	}
+}
+
+func (r *resolver) doLookup(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := r.lookup(ctx, host)
+	if err == nil && len(ips) == 0 {
+		err = errors.Errorf("no address found for %q", host)
+	}
+	if err != nil {
+		atomic.AddInt64(&r.errs, 1)
+		return nil, err
+	}
+	return ips, nil
+}
+
+func (r *resolver) stats() ResolverStats {
+	r.mu.Lock()
+	entries := int64(len(r.cache))
+	r.mu.Unlock()
+	return ResolverStats{
+		Lookups:      atomic.LoadInt64(&r.lookups),
+		Hits:         atomic.LoadInt64(&r.hits),
+		NegativeHits: atomic.LoadInt64(&r.negativeHits),
+		Overrides:    atomic.LoadInt64(&r.overrideHits),
+		Errors:       atomic.LoadInt64(&r.errs),
+		Entries:      entries,
+	}
+}
@@ -0,0 +1,87 @@
+package nethttp
+
+import (
+	"context"
+	"errors"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_ResolverOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	httpClient, err := NewHttpClient(&client.Config{
+		Resolver: client.ResolverConfig{
+			Overrides: map[string][]string{"backend.test:" + port: {"127.0.0.1"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, "http://backend.test:"+port+"/", nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.Equal(t, "backend.test:"+port, string(body))
+	}
+	assert.Equal(t, int64(1), httpClient.ResolverStats().Overrides)
+
+	_, err = NewHttpClient(&client.Config{
+		Resolver: client.ResolverConfig{Overrides: map[string][]string{"backend.test": {"invalid"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestResolver_Cache(t *testing.T) {
+	r, err := newResolver(client.ResolverConfig{
+		CacheTTL:    time.Minute,
+		NegativeTTL: time.Second,
+	}, time.Second)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	lookups := 0
+	r.lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+		lookups++
+		if host == "missing.test" {
+			return nil, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("10.0.0.1")}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		ips, err := r.resolve(context.Background(), "api.test", "443")
+		assert.NoError(t, err)
+		assert.Equal(t, "10.0.0.1", ips[0].String())
+	}
+	for i := 0; i < 2; i++ {
+		_, err := r.resolve(context.Background(), "missing.test", "443")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, lookups)
+
+	// 失败缓存过期后重新解析
+	now = now.Add(time.Second)
+	_, _ = r.resolve(context.Background(), "missing.test", "443")
+	_, _ = r.resolve(context.Background(), "api.test", "443")
+	assert.Equal(t, 3, lookups)
+
+	assert.Equal(t, ResolverStats{
+		Lookups:      7,
+		Hits:         3,
+		NegativeHits: 1,
+		Errors:       2,
+		Entries:      2,
+	}, r.stats())
+}
@@ -0,0 +1,177 @@
+package nethttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrBlockedAddress 目标地址被 SSRF 防护拒绝, 可以通过 errors.Is 判断
+var ErrBlockedAddress = errors.New("address is blocked by ssrf guard")
+
+// BlockedAddressError SSRF 防护拒绝连接, IP 为实际要连接的地址
+type BlockedAddressError struct {
+	IP      net.IP
+	Address string
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("connection to %s (%s) is blocked by ssrf guard", e.IP, e.Address)
+}
+
+func (e *BlockedAddressError) Is(target error) bool {
+	return target == ErrBlockedAddress
+}
+
+var defaultDeniedCIDRs = []string{
+	"0.0.0.0/8",      // 未指定地址
+	"10.0.0.0/8",     // RFC1918
+	"100.64.0.0/10",  // 运营商 NAT
+	"127.0.0.0/8",    // 回环
+	"169.254.0.0/16", // 链路本地, 包括云厂商元数据 169.254.169.254
+	"172.16.0.0/12",  // RFC1918
+	"192.0.0.0/24",   // IETF 协议分配
+	"192.168.0.0/16", // RFC1918
+	"198.18.0.0/15",  // 基准测试
+	"224.0.0.0/4",    // 组播
+	"240.0.0.0/4",    // 保留地址, 包括广播
+	"::/128",         // 未指定地址
+	"::1/128",        // 回环
+	"fc00::/7",       // 唯一本地地址, 包括 fd00:ec2::254
+	"fe80::/10",      // 链路本地
+	"ff00::/8",       // 组播
+	"64:ff9b::/96",   // NAT64, 可以映射到内网 IPv4
+	"2001:db8::/32",  // 文档示例
+}
+
+type ssrfGuard struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newSSRFGuard 未开启时返回 nil
+func newSSRFGuard(config client.SSRFGuardConfig) (*ssrfGuard, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	allow, err := parseCIDRs(config.AllowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCIDRs(append(append([]string{}, defaultDeniedCIDRs...), config.DenyCIDRs...))
+	if err != nil {
+		return nil, err
+	}
+	return &ssrfGuard{allow: allow, deny: deny}, nil
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, errors.Errorf("invalid ip %q", value)
+			}
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cidr %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (g *ssrfGuard) allowed(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range g.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	for _, network := range g.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// control 在 socket 连接前检查目标 IP, 此时 DNS 已经解析完成, 可以防止 DNS rebinding
+func (g *ssrfGuard) control(network string, address string, _ syscall.RawConn) error {
+	// Unix socket 没有 IP 地址, 不做检查
+	if strings.HasPrefix(network, "unix") {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("invalid dial address %q", address)
+	}
+	if !g.allowed(ip) {
+		return &BlockedAddressError{IP: ip, Address: address}
+	}
+	return nil
+}
+
+// guardProxy 使用代理时连接的是代理的地址, 在选择代理后检查目标主机解析出的 IP.
+// 目标主机由代理解析, 这里的检查无法防止 DNS rebinding
+func (g *ssrfGuard) guardProxy(proxy func(*http.Request) (*url.URL, error), resolver *resolver) func(*http.Request) (*url.URL, error) {
+	return func(request *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(request)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if err = g.checkTarget(request.Context(), resolver, request.URL); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+}
+
+func (g *ssrfGuard) checkTarget(ctx context.Context, resolver *resolver, target *url.URL) error {
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	var ips []net.IP
+	var err error
+	if resolver != nil {
+		ips, err = resolver.resolve(ctx, host, port)
+	} else if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %q for ssrf guard", host)
+	}
+	for _, ip := range ips {
+		if !g.allowed(ip) {
+			return &BlockedAddressError{IP: ip, Address: net.JoinHostPort(host, port)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSRFGuard_Allowed(t *testing.T) {
+	guard, err := newSSRFGuard(client.SSRFGuardConfig{
+		Enabled:    true,
+		DenyCIDRs:  []string{"203.0.113.0/24"},
+		AllowCIDRs: []string{"10.1.2.3"},
+	})
+	assert.NoError(t, err)
+
+	for _, ip := range []string{"127.0.0.1", "10.0.0.1", "172.16.5.4", "192.168.1.1", "169.254.169.254", "::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1", "203.0.113.9"} {
+		assert.False(t, guard.allowed(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "2001:4860:4860::8888", "10.1.2.3"} {
+		assert.True(t, guard.allowed(net.ParseIP(ip)), ip)
+	}
+
+	guard, err = newSSRFGuard(client.SSRFGuardConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, guard)
+
+	_, err = newSSRFGuard(client.SSRFGuardConfig{Enabled: true, DenyCIDRs: []string{"invalid"}})
+	assert.Error(t, err)
+}
+
+func TestClient_SSRFGuard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	httpClient, err := NewHttpClient(&client.Config{
+		SSRFGuard: client.SSRFGuardConfig{Enabled: true},
+		Resolver:  client.ResolverConfig{Overrides: map[string][]string{"internal.example": {"127.0.0.1"}}},
+	})
+	assert.NoError(t, err)
+
+	// 检查的是 DNS 解析之后的地址
+	request, _ := http.NewRequest(http.MethodGet, "http://internal.example:"+port, nil)
+	_, err = httpClient.DoRequest(request)
+	assert.True(t, errors.Is(err, ErrBlockedAddress))
+	var blocked *BlockedAddressError
+	if assert.True(t, errors.As(err, &blocked)) {
+		assert.Equal(t, "127.0.0.1", blocked.IP.String())
+	}
+
+	httpClient, err = NewHttpClient(&client.Config{
+		SSRFGuard: client.SSRFGuardConfig{Enabled: true, AllowCIDRs: []string{"127.0.0.1/32"}},
+	})
+	assert.NoError(t, err)
+	request, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		_ = response.Body.Close()
+	}
+}
+
+func TestClient_SSRFGuardRedirect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skip("127.0.0.2 is not available:", err)
+	}
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	internal.Listener = listener
+	internal.Start()
+	defer internal.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	httpClient, err := NewHttpClient(&client.Config{
+		SSRFGuard: client.SSRFGuardConfig{Enabled: true, AllowCIDRs: []string{"127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+
+	// 重定向的每一跳都会重新检查
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err = httpClient.DoRequest(request)
+	var blocked *BlockedAddressError
+	if assert.True(t, errors.As(err, &blocked)) {
+		assert.Equal(t, "127.0.0.2", blocked.IP.String())
+	}
+}
+
+func TestClient_SSRFGuardProxy(t *testing.T) {
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("proxied " + r.Host))
+	}))
+	defer proxyServer.Close()
+
+	httpClient, err := NewHttpClient(&client.Config{
+		ProxyURL:  proxyServer.URL,
+		SSRFGuard: client.SSRFGuardConfig{Enabled: true, AllowCIDRs: []string{"127.0.0.1"}},
+		Resolver: client.ResolverConfig{Overrides: map[string][]string{
+			"internal.example": {"10.0.0.1"},
+			"public.example":   {"93.184.216.34"},
+		}},
+	})
+	assert.NoError(t, err)
+
+	// 使用代理时检查目标主机, 而不只是代理的地址
+	request, _ := http.NewRequest(http.MethodGet, "http://internal.example/", nil)
+	_, err = httpClient.DoRequest(request)
+	var blocked *BlockedAddressError
+	if assert.True(t, errors.As(err, &blocked)) {
+		assert.Equal(t, "10.0.0.1", blocked.IP.String())
+		assert.Equal(t, "internal.example:80", blocked.Address)
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, "http://public.example/", nil)
+	response, err := httpClient.DoRequest(request)
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.Equal(t, "proxied public.example", string(body))
+	}
+}
@@ -0,0 +1,155 @@
+package nethttp
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutTracker 通过 httptrace 记录请求所处的阶段, 用于判断超时发生在哪个阶段
+type timeoutTracker struct {
+	parent    context.Context
+	timeout   time.Duration
+	transport client.TransportConfig
+	start     time.Time
+
+	mu    sync.Mutex
+	phase client.TimeoutPhase
+
+	bodyIdle int32
+}
+
+func newTimeoutTracker(parent context.Context, timeout time.Duration, transport client.TransportConfig) *timeoutTracker {
+	return &timeoutTracker{
+		parent:    parent,
+		timeout:   timeout,
+		transport: transport,
+		start:     time.Now(),
+	}
+}
+
+func (t *timeoutTracker) setPhase(phase client.TimeoutPhase) {
+	t.mu.Lock()
+	t.phase = phase
+	t.mu.Unlock()
+}
+
+func (t *timeoutTracker) getPhase() client.TimeoutPhase {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phase
+}
+
+func (t *timeoutTracker) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.setPhase(client.TimeoutPhaseConnect)
+		},
+		ConnectStart: func(string, string) {
+			t.setPhase(client.TimeoutPhaseConnect)
+		},
+		TLSHandshakeStart: func() {
+			t.setPhase(client.TimeoutPhaseTLSHandshake)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.setPhase("")
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.setPhase("")
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.setPhase(client.TimeoutPhaseResponseHeader)
+		},
+		GotFirstResponseByte: func() {
+			t.setPhase("")
+		},
+	}
+}
+
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// wrapError 将超时错误转换为 client.TimeoutError, 调用方 context 自身的超时与取消保持原样返回
+func (t *timeoutTracker) wrapError(err error) error {
+	if err == nil || t.parent.Err() != nil {
+		return err
+	}
+	// 读取空闲超时通过取消 context 中断读取, 返回的是 context.Canceled
+	if atomic.LoadInt32(&t.bodyIdle) == 1 {
+		return &client.TimeoutError{Phase: client.TimeoutPhaseBodyIdle, Duration: t.transport.BodyIdleTimeout, Err: err}
+	}
+	if !isTimeoutError(err) {
+		return err
+	}
+	if t.timeout > 0 && time.Since(t.start) >= t.timeout {
+		return &client.TimeoutError{Phase: client.TimeoutPhaseRequest, Duration: t.timeout, Err: err}
+	}
+
+	switch phase := t.getPhase(); phase {
+	case client.TimeoutPhaseConnect:
+		return &client.TimeoutError{Phase: phase, Duration: t.transport.DialTimeout, Err: err}
+	case client.TimeoutPhaseTLSHandshake:
+		return &client.TimeoutError{Phase: phase, Duration: t.transport.TLSHandshakeTimeout, Err: err}
+	case client.TimeoutPhaseResponseHeader:
+		return &client.TimeoutError{Phase: phase, Duration: t.transport.ResponseHeaderTimeout, Err: err}
+	default:
+		return &client.TimeoutError{Phase: client.TimeoutPhaseRequest, Duration: t.timeout, Err: err}
+	}
+}
+
+// wrapBody 包装响应体: 读取错误转换为超时错误, 按 BodyIdleTimeout 检测读取空闲, 关闭时释放 context
+func (t *timeoutTracker) wrapBody(body io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	b := &timeoutBody{
+		ReadCloser: body,
+		tracker:    t,
+		cancel:     cancel,
+	}
+	if idle := t.transport.BodyIdleTimeout; idle > 0 {
+		b.idle = idle
+		b.timer = time.AfterFunc(idle, func() {
+			atomic.StoreInt32(&t.bodyIdle, 1)
+			cancel()
+		})
+	}
+	return b
+}
+
+type timeoutBody struct {
+	io.ReadCloser
+	tracker *timeoutTracker
+	cancel  context.CancelFunc
+	idle    time.Duration
+	timer   *time.Timer
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.timer != nil && err == nil {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && err != io.EOF {
+		err = b.tracker.wrapError(err)
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
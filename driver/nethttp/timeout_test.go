@@ -0,0 +1,78 @@
+package nethttp
+
+import (
+	"context"
+	"errors"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func assertTimeoutPhase(t *testing.T, err error, phase client.TimeoutPhase) {
+	var timeoutErr *client.TimeoutError
+	if assert.True(t, errors.As(err, &timeoutErr), "unexpected error: %v", err) {
+		assert.Equal(t, phase, timeoutErr.Phase)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-body" {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	httpClient, err := NewHttpClient(&client.Config{
+		Transport: client.TransportConfig{
+			ResponseHeaderTimeout: 50 * time.Millisecond,
+			BodyIdleTimeout:       50 * time.Millisecond,
+		},
+	})
+	assert.NoError(t, err)
+
+	t.Run("response header", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err := httpClient.DoRequest(request)
+		assertTimeoutPhase(t, err, client.TimeoutPhaseResponseHeader)
+	})
+
+	t.Run("request", func(t *testing.T) {
+		ctx := client.WithRequestTimeout(context.Background(), 20*time.Millisecond)
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		_, err := httpClient.DoRequest(request)
+		assertTimeoutPhase(t, err, client.TimeoutPhaseRequest)
+	})
+
+	t.Run("body idle", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/slow-body", nil)
+		response, err := httpClient.DoRequest(request)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		assert.Equal(t, "partial", string(body))
+		assertTimeoutPhase(t, err, client.TimeoutPhaseBodyIdle)
+	})
+
+	t.Run("caller context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		_, err := httpClient.DoRequest(request)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var timeoutErr *client.TimeoutError
+		assert.False(t, errors.As(err, &timeoutErr))
+	})
+}
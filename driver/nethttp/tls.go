@@ -0,0 +1,98 @@
+package nethttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// newTlsConfig 根据配置构建 tls.Config, 没有任何 tls 相关配置时返回 nil 以使用默认配置
+func newTlsConfig(config client.Config) (*tls.Config, error) {
+	cert := config.Cert
+	options := config.Tls
+	hasCert := (len(cert.CertPEM) > 0 && len(cert.KeyPEM) > 0) || (cert.CertFile != "" && cert.KeyFile != "") ||
+		cert.Provider != nil
+	hasRootCA := options.RootCAFile != "" || len(options.RootCAPEM) > 0
+	if config.TlsConfig == nil && !hasCert && !hasRootCA &&
+		options.MinVersion == 0 && options.MaxVersion == 0 && len(options.CipherSuites) == 0 &&
+		options.ServerName == "" && !options.InsecureSkipVerify && len(options.Pins) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TlsConfig != nil {
+		tlsConfig = config.TlsConfig.Clone()
+	}
+
+	reloadable := cert.Provider != nil ||
+		(cert.ReloadInterval > 0 && cert.CertFile != "" && cert.KeyFile != "" && len(cert.CertPEM) == 0)
+	if reloadable {
+		reloader, err := newCertReloader(cert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	} else if hasCert {
+		certPair, err := loadCertificate(cert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certPair}
+	}
+
+	if hasRootCA {
+		pool := x509.NewCertPool()
+		if options.RootCAFile != "" {
+			pem, err := os.ReadFile(options.RootCAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read root ca file")
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no valid certificate found in root ca file")
+			}
+		}
+		if len(options.RootCAPEM) > 0 && !pool.AppendCertsFromPEM(options.RootCAPEM) {
+			return nil, errors.New("no valid certificate found in root ca pem")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.MinVersion != 0 {
+		tlsConfig.MinVersion = options.MinVersion
+	}
+	if options.MaxVersion != 0 {
+		tlsConfig.MaxVersion = options.MaxVersion
+	}
+	if len(options.CipherSuites) > 0 {
+		tlsConfig.CipherSuites = options.CipherSuites
+	}
+	if options.ServerName != "" {
+		tlsConfig.ServerName = options.ServerName
+	}
+	if options.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if len(options.Pins) > 0 {
+		tlsConfig.VerifyConnection = newPinVerifier(options.Pins, tlsConfig.VerifyConnection)
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertificate(cert client.CertConfig) (tls.Certificate, error) {
+	if len(cert.CertPEM) > 0 && len(cert.KeyPEM) > 0 {
+		certPair, err := tls.X509KeyPair(cert.CertPEM, cert.KeyPEM)
+		if err != nil {
+			return tls.Certificate{}, errors.Wrap(err, "failed to parse certificate")
+		}
+		return certPair, nil
+	}
+	certPair, err := tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "failed to load certificate")
+	}
+	return certPair, nil
+}
@@ -0,0 +1,143 @@
+package nethttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serverCertPEM(server *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+func TestNewHttpClient_Tls(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cases := []struct {
+		name   string
+		config client.Config
+		ok     bool
+	}{
+		{name: "default", config: client.Config{}, ok: false},
+		{name: "root ca pem", config: client.Config{Tls: client.TlsOptions{RootCAPEM: serverCertPEM(server)}}, ok: true},
+		{name: "insecure", config: client.Config{Tls: client.TlsOptions{InsecureSkipVerify: true}}, ok: true},
+		{name: "custom tls config", config: client.Config{TlsConfig: &tls.Config{InsecureSkipVerify: true}}, ok: true},
+		{
+			name: "server name mismatch",
+			config: client.Config{Tls: client.TlsOptions{
+				RootCAPEM:  serverCertPEM(server),
+				ServerName: "invalid.test",
+			}},
+			ok: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			httpClient, err := NewHttpClient(&c.config)
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			response, err := httpClient.DoRequest(request)
+			if c.ok {
+				assert.NoError(t, err)
+				_ = response.Body.Close()
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewHttpClient_TlsInvalid(t *testing.T) {
+	_, err := NewHttpClient(&client.Config{Tls: client.TlsOptions{RootCAPEM: []byte("invalid")}})
+	assert.Error(t, err)
+
+	_, err = NewHttpClient(&client.Config{Cert: client.CertConfig{CertPEM: []byte("invalid"), KeyPEM: []byte("invalid")}})
+	assert.Error(t, err)
+}
+
+func TestNewHttpClient_Pins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pin := SPKIPin(server.Certificate())
+
+	newClient := func(pins map[string][]string) *Client {
+		// 指纹按 SNI 主机名匹配, httptest 的证书包含 example.com
+		httpClient, err := NewHttpClient(&client.Config{Tls: client.TlsOptions{
+			RootCAPEM:  serverCertPEM(server),
+			ServerName: "example.com",
+			Pins:       pins,
+		}})
+		assert.NoError(t, err)
+		return httpClient
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	response, err := newClient(map[string][]string{"*.com": {"sha256/invalid"}, "example.com": {"sha256/invalid", pin}}).DoRequest(request)
+	assert.NoError(t, err)
+	_ = response.Body.Close()
+
+	// 未配置指纹的主机不校验
+	response, err = newClient(map[string][]string{"api.example.com": {"invalid"}}).DoRequest(request)
+	assert.NoError(t, err)
+	_ = response.Body.Close()
+
+	_, err = newClient(map[string][]string{"*.com": {"invalid"}}).DoRequest(request)
+	assert.ErrorIs(t, err, ErrPinMismatch)
+	var mismatch *PinMismatchError
+	if assert.True(t, errors.As(err, &mismatch)) {
+		assert.Equal(t, []string{pin}, mismatch.Presented)
+	}
+}
+
+func TestNewHttpClient_PinsUnverifiedCert(t *testing.T) {
+	// 服务端在证书链末尾附带一张未经验证的证书, 其指纹不能通过校验
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pinned.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	extraDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	extra, _ := x509.ParseCertificate(extraDER)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.StartTLS()
+	defer server.Close()
+	server.TLS.Certificates[0].Certificate = append(server.TLS.Certificates[0].Certificate, extraDER)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	for _, options := range []client.TlsOptions{
+		{RootCAPEM: serverCertPEM(server), ServerName: "example.com"},
+		{InsecureSkipVerify: true, ServerName: "example.com"},
+	} {
+		options.Pins = map[string][]string{"example.com": {SPKIPin(extra)}}
+		httpClient, err := NewHttpClient(&client.Config{Tls: options})
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = httpClient.DoRequest(request)
+		assert.ErrorIs(t, err, ErrPinMismatch)
+	}
+}
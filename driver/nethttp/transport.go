@@ -0,0 +1,50 @@
+package nethttp
+
+import (
+	"crypto/tls"
+	"github.com/artisancloud/httphelper/client"
+	"net/http"
+)
+
+// newTransport 基于 http.DefaultTransport 应用连接池与传输层配置, 0 值保持 http.DefaultTransport 的设置
+func newTransport(config client.TransportConfig, dialer *dialer) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if dialer != nil {
+		transport.DialContext = dialer.DialContext
+	}
+	if config.MaxIdleConns != 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost != 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	if config.TLSHandshakeTimeout != 0 {
+		transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+	if config.ResponseHeaderTimeout != 0 {
+		transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+	if config.ExpectContinueTimeout != 0 {
+		transport.ExpectContinueTimeout = config.ExpectContinueTimeout
+	}
+	if config.ReadBufferSize != 0 {
+		transport.ReadBufferSize = config.ReadBufferSize
+	}
+	if config.WriteBufferSize != 0 {
+		transport.WriteBufferSize = config.WriteBufferSize
+	}
+	transport.DisableCompression = config.DisableCompression
+	if config.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
+	}
+
+	return transport
+}
@@ -0,0 +1,53 @@
+package nethttp
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewHttpClient_TransportDefault(t *testing.T) {
+	httpClient, err := NewHttpClient(nil)
+	assert.NoError(t, err)
+
+	transport := httpClient.coreClient.Transport.(*http.Transport)
+	assert.Equal(t, 100, transport.MaxIdleConns)
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Equal(t, 30*time.Second, httpClient.coreClient.Timeout)
+
+	// 传入的配置不会被修改, Timeout 为 0 表示不限制
+	config := &client.Config{}
+	httpClient, err = NewHttpClient(config)
+	assert.NoError(t, err)
+	assert.Equal(t, client.Config{}, *config)
+	assert.Equal(t, time.Duration(0), httpClient.coreClient.Timeout)
+	assert.Equal(t, 100, httpClient.coreClient.Transport.(*http.Transport).MaxIdleConns)
+
+	// SetConfig 与 NewHttpClient 使用相同的默认值
+	assert.NoError(t, httpClient.SetConfig(client.Config{}))
+	assert.Equal(t, time.Duration(0), httpClient.coreClient.Timeout)
+	assert.Equal(t, time.Duration(0), httpClient.GetConfig().Timeout)
+	assert.Equal(t, 100, httpClient.coreClient.Transport.(*http.Transport).MaxIdleConns)
+}
+
+func TestNewTransport(t *testing.T) {
+	transport := newTransport(client.TransportConfig{
+		MaxIdleConnsPerHost:   64,
+		MaxConnsPerHost:       128,
+		ResponseHeaderTimeout: 5 * time.Second,
+		DisableCompression:    true,
+		DisableHTTP2:          true,
+		ReadBufferSize:        64 << 10,
+	}, nil)
+	assert.Equal(t, 64, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 128, transport.MaxConnsPerHost)
+	assert.Equal(t, 5*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 64<<10, transport.ReadBufferSize)
+	assert.True(t, transport.DisableCompression)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+}
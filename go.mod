@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/net v0.17.0
 )
 
 require (
@@ -0,0 +1,249 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/dataflow"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type HedgeConfig struct {
+	// Delay 发送下一个对冲请求前的等待时长, 默认 100ms, 启用 Percentile 时作为样本不足时的兜底
+	Delay time.Duration
+	// MaxHedges 额外发送的请求副本数, 默认 1
+	MaxHedges int
+	// Percentile 大于 0 时使用观测到的该分位延迟作为等待时长, 例如 0.95
+	Percentile float64
+	// MinSamples 使用分位延迟前至少需要的样本数, 默认 20
+	MinSamples int
+	// Samples 保留的最近延迟样本数, 默认 200
+	Samples int
+	// IsIdempotent 判断请求是否允许对冲, 默认 GET/HEAD/OPTIONS 或带有 Idempotency-Key 请求头的请求
+	IsIdempotent func(request *http.Request) bool
+}
+
+func (c *HedgeConfig) Default() {
+	if c.Delay <= 0 {
+		c.Delay = 100 * time.Millisecond
+	}
+	if c.MaxHedges <= 0 {
+		c.MaxHedges = 1
+	}
+	if c.Percentile > 1 {
+		c.Percentile = 1
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 20
+	}
+	if c.Samples <= 0 {
+		c.Samples = 200
+	}
+	if c.MinSamples > c.Samples {
+		c.MinSamples = c.Samples
+	}
+	if c.IsIdempotent == nil {
+		c.IsIdempotent = defaultIsIdempotent
+	}
+}
+
+func defaultIsIdempotent(request *http.Request) bool {
+	switch request.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return request.Header.Get("Idempotency-Key") != ""
+}
+
+// Hedger 对幂等请求发送对冲副本, 返回最先成功的响应
+type Hedger struct {
+	config HedgeConfig
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+func NewHedger(config HedgeConfig) *Hedger {
+	config.Default()
+	return &Hedger{
+		config:    config,
+		latencies: make([]time.Duration, 0, config.Samples),
+	}
+}
+
+// HedgeMiddleware 创建对冲器并返回其中间件
+func HedgeMiddleware(config HedgeConfig) dataflow.RequestMiddleware {
+	return NewHedger(config).Middleware()
+}
+
+type hedgeResult struct {
+	index    int
+	response *http.Response
+	err      error
+	cancel   context.CancelFunc
+	latency  time.Duration
+}
+
+func (h *Hedger) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			if !h.config.IsIdempotent(request) || !isReplayableRequest(request) {
+				return handle(request, response)
+			}
+
+			ctx := request.Context()
+			total := h.config.MaxHedges + 1
+			results := make(chan hedgeResult, total)
+			cancels := make([]context.CancelFunc, 0, total)
+			launch := func() error {
+				attemptCtx, cancel := context.WithCancel(ctx)
+				attemptRequest, err := rewindRequest(request.WithContext(attemptCtx))
+				if err != nil {
+					cancel()
+					return err
+				}
+				index := len(cancels)
+				cancels = append(cancels, cancel)
+				go func() {
+					start := time.Now()
+					attemptResponse := new(http.Response)
+					err := handle(attemptRequest, attemptResponse)
+					results <- hedgeResult{
+						index:    index,
+						response: attemptResponse,
+						err:      err,
+						cancel:   cancel,
+						latency:  time.Since(start),
+					}
+				}()
+				return nil
+			}
+
+			if err := launch(); err != nil {
+				return err
+			}
+			launched, received := 1, 0
+			// abort 补发副本失败时取消已发出的请求并关闭它们的响应
+			abort := func(err error) error {
+				for _, cancel := range cancels {
+					cancel()
+				}
+				go h.discard(results, launched-received)
+				return err
+			}
+			delay := h.delay()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			var last hedgeResult
+			for received < launched {
+				select {
+				case result := <-results:
+					received++
+					if result.err == nil {
+						h.observe(result.latency)
+						// 取消其余请求, winner 的 context 在响应体关闭时取消
+						for i, cancel := range cancels {
+							if i != result.index {
+								cancel()
+							}
+						}
+						go h.discard(results, launched-received)
+						if result.response.Body != nil {
+							result.response.Body = &cancelOnClose{ReadCloser: result.response.Body, cancel: result.cancel}
+						} else {
+							result.cancel()
+						}
+						*response = *result.response
+						return nil
+					}
+					result.cancel()
+					last = result
+					// 失败时立即补发下一个副本
+					if launched < total && ctx.Err() == nil {
+						if err := launch(); err != nil {
+							return abort(err)
+						}
+						launched++
+						// go1.23 之前 Reset 不会清空已经触发的 timer, 需要先停止并取出未读的值
+						if !timer.Stop() {
+							select {
+							case <-timer.C:
+							default:
+							}
+						}
+						timer.Reset(delay)
+					}
+				case <-timer.C:
+					if launched < total {
+						if err := launch(); err != nil {
+							return abort(err)
+						}
+						launched++
+						timer.Reset(delay)
+					}
+				}
+			}
+			*response = *last.response
+			return last.err
+		}
+	}
+}
+
+// discard 关闭已被取消的落后请求的响应
+func (h *Hedger) discard(results chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		result := <-results
+		if result.err == nil {
+			discardResponseBody(result.response)
+		}
+	}
+}
+
+// delay 返回当前的对冲等待时长
+func (h *Hedger) delay() time.Duration {
+	if h.config.Percentile <= 0 {
+		return h.config.Delay
+	}
+	h.mu.Lock()
+	if len(h.latencies) < h.config.MinSamples {
+		h.mu.Unlock()
+		return h.config.Delay
+	}
+	samples := make([]time.Duration, len(h.latencies))
+	copy(samples, h.latencies)
+	h.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	index := int(float64(len(samples)-1) * h.config.Percentile)
+	return samples[index]
+}
+
+func (h *Hedger) observe(latency time.Duration) {
+	if h.config.Percentile <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < h.config.Samples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % h.config.Samples
+}
+
+// cancelOnClose 关闭响应体时释放请求 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,133 @@
+package httphelper
+
+import (
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeMiddleware(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// 第一个副本很慢, 直到被取消
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("fast"))
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(HedgeMiddleware(HedgeConfig{
+		Delay: 20 * time.Millisecond,
+	}))
+
+	start := time.Now()
+	res, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Body.Close())
+	assert.Equal(t, "fast", string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestHedgeMiddleware_NonIdempotent(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(HedgeMiddleware(HedgeConfig{
+		Delay: time.Millisecond,
+	}))
+
+	_, err := helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("data")).Request()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 带 Idempotency-Key 的请求允许对冲, 并且请求体可以重放
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "data", string(body))
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+	})
+	_, err = helper.Df().Method(http.MethodPost).Uri("/").
+		Header("Idempotency-Key", "abc").
+		Body(strings.NewReader("data")).
+		Request()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestHedger_Percentile(t *testing.T) {
+	hedger := NewHedger(HedgeConfig{
+		Delay:      time.Second,
+		Percentile: 0.9,
+		MinSamples: 10,
+		Samples:    10,
+	})
+	assert.Equal(t, time.Second, hedger.delay())
+
+	for i := 1; i <= 20; i++ {
+		hedger.observe(time.Duration(i) * time.Millisecond)
+	}
+	// 只保留最近的 10 个样本: 11ms ~ 20ms
+	assert.Equal(t, 19*time.Millisecond, hedger.delay())
+}
+
+func TestHedgeMiddleware_LaunchError(t *testing.T) {
+	canceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务端才能感知连接关闭
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	// 第二次重置请求体失败, 对冲副本无法发出
+	var rewinds int32
+	helper.WithMiddleware(func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			getBody := request.GetBody
+			request.GetBody = func() (io.ReadCloser, error) {
+				if atomic.AddInt32(&rewinds, 1) > 1 {
+					return nil, errors.New("body is gone")
+				}
+				return getBody()
+			}
+			return handle(request, response)
+		}
+	}, HedgeMiddleware(HedgeConfig{Delay: 10 * time.Millisecond}))
+
+	_, err := helper.Df().Method(http.MethodPut).Uri("/").Header("Idempotency-Key", "1").
+		Body(strings.NewReader("data")).Request()
+	assert.ErrorContains(t, err, "body is gone")
+	// 已发出的请求被取消
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("first attempt was not canceled")
+	}
+}
@@ -0,0 +1,16 @@
+package httphelper
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestHelper(t *testing.T, server *httptest.Server) Helper {
+	helper, err := NewRequestHelper(&Config{
+		BaseUrl: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return helper
+}
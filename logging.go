@@ -0,0 +1,462 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/artisancloud/httphelper/dataflow"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel 日志级别, 取值与 log/slog 一致
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = -4
+	LogLevelInfo  LogLevel = 0
+	LogLevelWarn  LogLevel = 4
+	LogLevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l >= LogLevelError:
+		return "ERROR"
+	case l >= LogLevelWarn:
+		return "WARN"
+	case l >= LogLevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// LogField 结构化日志字段
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger 结构化日志接口, Go 1.21 及以上可以通过 SlogLogger 使用 *slog.Logger
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, fields ...LogField)
+}
+
+// NewStdLogger 使用标准库 log 输出 key=value 格式的日志, logger 为 nil 时使用 log.Default()
+func NewStdLogger(logger *log.Logger) Logger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &stdLogger{logger: logger}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l *stdLogger) Log(_ context.Context, level LogLevel, msg string, fields ...LogField) {
+	var buf strings.Builder
+	buf.WriteString(level.String())
+	buf.WriteString(" ")
+	buf.WriteString(msg)
+	for _, field := range fields {
+		buf.WriteString(" ")
+		buf.WriteString(field.Key)
+		buf.WriteString("=")
+		buf.WriteString(fmt.Sprintf("%q", fmt.Sprint(field.Value)))
+	}
+	l.logger.Print(buf.String())
+}
+
+const redacted = "[REDACTED]"
+
+type LoggingConfig struct {
+	// Logger 默认 NewStdLogger(nil)
+	Logger Logger
+	// Message 日志消息, 默认 http request
+	Message string
+	// RedactHeaders 脱敏的请求头与响应头, 默认 Authorization, Proxy-Authorization, Cookie, Set-Cookie, X-Api-Key
+	RedactHeaders []string
+	// RedactQuery 脱敏的查询参数与表单字段, 默认 access_token, refresh_token, token, password, secret, client_secret
+	RedactQuery []string
+	// RedactFields 脱敏的 JSON 字段, 匹配任意层级, 默认与 RedactQuery 相同
+	RedactFields []string
+	// LogHeaders 是否记录请求头与响应头
+	LogHeaders bool
+	// LogBody 是否记录请求体与响应体, 只记录前 MaxBodySize 字节, 不会影响调用方读取响应体.
+	// 响应体长度未知或超过 MaxBodySize 时(例如流式响应)在调用方读完或关闭响应体时才输出日志
+	LogBody bool
+	// MaxBodySize 记录的请求体与响应体最大长度, 默认 1024
+	MaxBodySize int
+	// SampleRate 成功请求(状态码小于 400)的采样比例, 取值 (0, 1], 默认 1, 失败的请求总是记录
+	SampleRate float64
+	// Level 按状态码与错误确定日志级别, 默认出错或 5xx 为 Error, 4xx 为 Warn, 其余为 Info
+	Level func(statusCode int, err error) LogLevel
+}
+
+func (c *LoggingConfig) Default() {
+	if c.Logger == nil {
+		c.Logger = NewStdLogger(nil)
+	}
+	if c.Message == "" {
+		c.Message = "http request"
+	}
+	if c.RedactHeaders == nil {
+		c.RedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	}
+	if c.RedactQuery == nil {
+		c.RedactQuery = defaultRedactQuery
+	}
+	if c.RedactFields == nil {
+		c.RedactFields = c.RedactQuery
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = 1024
+	}
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		c.SampleRate = 1
+	}
+	if c.Level == nil {
+		c.Level = defaultLogLevel
+	}
+}
+
+func defaultLogLevel(statusCode int, err error) LogLevel {
+	switch {
+	case err != nil || statusCode >= http.StatusInternalServerError:
+		return LogLevelError
+	case statusCode >= http.StatusBadRequest:
+		return LogLevelWarn
+	default:
+		return LogLevelInfo
+	}
+}
+
+// RequestLogger 记录请求方法, URL, 状态码, 耗时与大小等结构化日志, 按配置对敏感信息脱敏
+type RequestLogger struct {
+	config   LoggingConfig
+	redactor *redactor
+	random   func() float64
+}
+
+func NewRequestLogger(config LoggingConfig) *RequestLogger {
+	config.Default()
+	var mu sync.Mutex
+	source := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &RequestLogger{
+		config:   config,
+		redactor: newRedactor(config.RedactHeaders, config.RedactQuery, config.RedactFields),
+		random: func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return source.Float64()
+		},
+	}
+}
+
+// LoggingMiddleware 创建请求日志记录器并返回其中间件
+func LoggingMiddleware(config LoggingConfig) dataflow.RequestMiddleware {
+	return NewRequestLogger(config).Middleware()
+}
+
+func (l *RequestLogger) Middleware() dataflow.RequestMiddleware {
+	config := l.config
+	r := l.redactor
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			var requestBody string
+			if config.LogBody {
+				requestBody = r.requestBody(request, config.MaxBodySize)
+			}
+
+			start := time.Now()
+			err := handle(request, response)
+			duration := time.Since(start)
+
+			failed := err != nil || response.StatusCode >= http.StatusBadRequest
+			if !failed && config.SampleRate < 1 && l.random() >= config.SampleRate {
+				return err
+			}
+
+			method := request.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			fields := []LogField{
+				{Key: "method", Value: method},
+				{Key: "url", Value: r.url(request.URL)},
+			}
+			if route, ok := dataflow.RouteFromContext(request.Context()); ok {
+				fields = append(fields, LogField{Key: "route", Value: route})
+			}
+			if err == nil {
+				fields = append(fields, LogField{Key: "status", Value: response.StatusCode})
+			}
+			fields = append(fields,
+				LogField{Key: "duration", Value: duration},
+				LogField{Key: "request_size", Value: request.ContentLength},
+			)
+			if err == nil {
+				fields = append(fields, LogField{Key: "response_size", Value: response.ContentLength})
+			}
+			if config.LogHeaders {
+				fields = append(fields, LogField{Key: "request_headers", Value: r.headers(request.Header)})
+				if err == nil {
+					fields = append(fields, LogField{Key: "response_headers", Value: r.headers(response.Header)})
+				}
+			}
+			if config.LogBody {
+				fields = append(fields, LogField{Key: "request_body", Value: requestBody})
+				if err == nil {
+					body, ok := r.responseBody(response, config.MaxBodySize)
+					if !ok {
+						// 不等待流式响应, 在调用方读取响应体的同时记录
+						contentType := response.Header.Get("Content-Type")
+						level := config.Level(response.StatusCode, err)
+						ctx := request.Context()
+						response.Body = &teeBody{ReadCloser: response.Body, limit: config.MaxBodySize, done: func(data []byte) {
+							fields = append(fields, LogField{Key: "response_body", Value: r.body(contentType, data, config.MaxBodySize)})
+							config.Logger.Log(ctx, level, config.Message, fields...)
+						}}
+						return nil
+					}
+					fields = append(fields, LogField{Key: "response_body", Value: body})
+				}
+			}
+			if err != nil {
+				fields = append(fields,
+					LogField{Key: "error", Value: err.Error()},
+					LogField{Key: "error_category", Value: string(ClassifyError(err))},
+				)
+			}
+
+			config.Logger.Log(request.Context(), config.Level(response.StatusCode, err), config.Message, fields...)
+			return err
+		}
+	}
+}
+
+type redactor struct {
+	headerKeys map[string]bool
+	queryKeys  map[string]bool
+	fieldKeys  map[string]bool
+	pattern    *regexp.Regexp
+}
+
+// defaultRedactQuery 默认脱敏的查询参数, 与 TracingMiddleware 共用
+var defaultRedactQuery = []string{"access_token", "refresh_token", "token", "password", "secret", "client_secret"}
+
+func newRedactor(headers []string, query []string, fields []string) *redactor {
+	r := &redactor{
+		headerKeys: make(map[string]bool),
+		queryKeys:  make(map[string]bool),
+		fieldKeys:  make(map[string]bool),
+	}
+	for _, key := range headers {
+		r.headerKeys[http.CanonicalHeaderKey(key)] = true
+	}
+	for _, key := range query {
+		r.queryKeys[strings.ToLower(key)] = true
+	}
+	quoted := make([]string, 0, len(fields))
+	for _, key := range fields {
+		r.fieldKeys[strings.ToLower(key)] = true
+		quoted = append(quoted, regexp.QuoteMeta(key))
+	}
+	if len(quoted) > 0 {
+		// 响应体被截断无法解析时, 按字段名替换字符串值
+		r.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*("|$)`)
+	}
+	return r
+}
+
+func (r *redactor) url(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	copied := *u
+	copied.User = nil
+	if copied.RawQuery != "" {
+		copied.RawQuery = r.values(copied.RawQuery)
+	}
+	return copied.String()
+}
+
+// values 对查询参数或表单脱敏, 保持参数顺序
+func (r *redactor) values(raw string) string {
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key := part
+		if index := strings.IndexByte(part, '='); index >= 0 {
+			key = part[:index]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil && r.queryKeys[strings.ToLower(unescaped)] {
+			parts[i] = key + "=" + url.QueryEscape(redacted)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func (r *redactor) headers(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if r.headerKeys[http.CanonicalHeaderKey(key)] {
+			result[key] = redacted
+			continue
+		}
+		result[key] = strings.Join(header[key], ", ")
+	}
+	return result
+}
+
+// requestBody 通过 GetBody 读取请求体副本, 无法重放的请求体不记录
+func (r *redactor) requestBody(request *http.Request, limit int) string {
+	if request.Body == nil || request.Body == http.NoBody {
+		return ""
+	}
+	if request.GetBody == nil {
+		return "[stream]"
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	return r.body(request.Header.Get("Content-Type"), data, limit)
+}
+
+// responseBody 响应体长度已知且不超过 limit 时读取后放回, 调用方仍然可以读取完整的响应体.
+// 长度未知或超过 limit 时不读取, 返回 false, 由 teeBody 在调用方读取时记录
+func (r *redactor) responseBody(response *http.Response, limit int) (string, bool) {
+	if response.Body == nil || response.Body == http.NoBody {
+		return "", true
+	}
+	if response.ContentLength < 0 || response.ContentLength > int64(limit) {
+		return "", false
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, int64(limit)+1))
+	response.Body = &prefixBody{Reader: io.MultiReader(bytes.NewReader(data), response.Body), Closer: response.Body}
+	if err != nil && len(data) == 0 {
+		return "", true
+	}
+	return r.body(response.Header.Get("Content-Type"), data, limit), true
+}
+
+func (r *redactor) body(contentType string, data []byte, limit int) string {
+	truncated := len(data) > limit
+	if truncated {
+		data = data[:limit]
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		data = []byte(r.values(string(data)))
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		data = r.json(data, truncated)
+	}
+	if truncated {
+		return string(data) + "...(truncated)"
+	}
+	return string(data)
+}
+
+func (r *redactor) json(data []byte, truncated bool) []byte {
+	if !truncated {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if decoder.Decode(&value) == nil {
+			if encoded, err := json.Marshal(r.redactValue(value)); err == nil {
+				return encoded
+			}
+		}
+	}
+	if r.pattern == nil {
+		return data
+	}
+	return r.pattern.ReplaceAll(data, []byte(`${1}"`+redacted+`"`))
+}
+
+func (r *redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if r.fieldKeys[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = r.redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+	}
+	return value
+}
+
+// prefixBody 将已读取的部分放回响应体
+type prefixBody struct {
+	io.Reader
+	io.Closer
+}
+
+// teeBody 保留调用方读取的前 limit+1 字节, 读到结尾或关闭时调用一次 done
+// 调用方可能在读取的同时从其他 goroutine 关闭响应体, data 由 mu 保护
+type teeBody struct {
+	io.ReadCloser
+	limit int
+	done  func(data []byte)
+
+	mu   sync.Mutex
+	data []byte
+	once sync.Once
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if remaining := b.limit + 1 - len(b.data); remaining > 0 {
+		if n < remaining {
+			remaining = n
+		}
+		b.data = append(b.data, p[:remaining]...)
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *teeBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *teeBody) finish() {
+	b.once.Do(func() {
+		b.mu.Lock()
+		data := b.data
+		b.mu.Unlock()
+		b.done(data)
+	})
+}
@@ -0,0 +1,31 @@
+//go:build go1.21
+
+package httphelper
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger 将 *slog.Logger 适配为 Logger, logger 为 nil 时使用 slog.Default()
+func SlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	if !l.logger.Enabled(ctx, slog.Level(level)) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+	l.logger.LogAttrs(ctx, slog.Level(level), msg, attrs...)
+}
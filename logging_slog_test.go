@@ -0,0 +1,28 @@
+//go:build go1.21
+
+package httphelper
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(LoggingMiddleware(LoggingConfig{Logger: SlogLogger(logger)}))
+
+	_, err := helper.Df().Uri("/").Query("access_token", "abc").Request()
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "level=INFO msg=\"http request\" method=GET")
+	assert.Contains(t, buf.String(), "access_token=%5BREDACTED%5D")
+	assert.Contains(t, buf.String(), "status=200")
+}
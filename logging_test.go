@@ -0,0 +1,181 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	level  LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+type memoryLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *memoryLogger) Log(_ context.Context, level LogLevel, msg string, fields ...LogField) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := logEntry{level: level, msg: msg, fields: make(map[string]interface{})}
+	for _, field := range fields {
+		entry.fields[field.Key] = field.Value
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(`{"access_token":"tok","user":{"name":"bob","Password":"p"}}`))
+	}))
+	defer server.Close()
+
+	logger := &memoryLogger{}
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(LoggingMiddleware(LoggingConfig{Logger: logger, LogHeaders: true, LogBody: true}))
+
+	res, err := helper.Df().Method(http.MethodPost).Uri("/login").
+		Query("token", "abc").Query("page", "1").
+		Header("Authorization", "Bearer abc").
+		Json(map[string]string{"username": "bob", "password": "secret"}).
+		Request()
+	assert.NoError(t, err)
+	// 调用方仍然可以读取完整的响应体
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, `{"access_token":"tok","user":{"name":"bob","Password":"p"}}`, string(body))
+
+	if !assert.Len(t, logger.entries, 1) {
+		return
+	}
+	entry := logger.entries[0]
+	assert.Equal(t, LogLevelInfo, entry.level)
+	assert.Equal(t, "http request", entry.msg)
+	assert.Equal(t, "POST", entry.fields["method"])
+	assert.Equal(t, server.URL+"/login?page=1&token=%5BREDACTED%5D", entry.fields["url"])
+	assert.Equal(t, http.StatusOK, entry.fields["status"])
+	assert.Equal(t, "[REDACTED]", entry.fields["request_headers"].(map[string]string)["Authorization"])
+	assert.Equal(t, "[REDACTED]", entry.fields["response_headers"].(map[string]string)["Set-Cookie"])
+	assert.Equal(t, `{"password":"[REDACTED]","username":"bob"}`, entry.fields["request_body"])
+	assert.Equal(t, `{"access_token":"[REDACTED]","user":{"Password":"[REDACTED]","name":"bob"}}`, entry.fields["response_body"])
+}
+
+func TestLoggingMiddleware_Truncate(t *testing.T) {
+	payload := `{"name":"` + strings.Repeat("a", 20) + `","token":"abcdef"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	logger := &memoryLogger{}
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(LoggingMiddleware(LoggingConfig{Logger: logger, LogBody: true, MaxBodySize: 40}))
+
+	res, err := helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, payload, string(body))
+	if assert.Len(t, logger.entries, 1) {
+		assert.Equal(t, `{"name":"aaaaaaaaaaaaaaaaaaaa","token":"[REDACTED]"...(truncated)`, logger.entries[0].fields["response_body"])
+	}
+}
+
+func TestLoggingMiddleware_Stream(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+	defer server.Close()
+
+	logger := &memoryLogger{}
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(LoggingMiddleware(LoggingConfig{Logger: logger, LogBody: true}))
+
+	// 长度未知的响应不会等待服务端写完
+	res, err := helper.Df().Uri("/events").Request()
+	if !assert.NoError(t, err) {
+		close(release)
+		return
+	}
+	logger.mu.Lock()
+	assert.Len(t, logger.entries, 0)
+	logger.mu.Unlock()
+
+	close(release)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", string(body))
+	if assert.Len(t, logger.entries, 1) {
+		assert.Equal(t, "data: 1\n\ndata: 2\n\n", logger.entries[0].fields["response_body"])
+		assert.Equal(t, http.StatusOK, logger.entries[0].fields["status"])
+	}
+}
+
+func TestLoggingMiddleware_LevelAndSampling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	logger := &memoryLogger{}
+	helper := newTestHelper(t, server)
+	requestLogger := NewRequestLogger(LoggingConfig{
+		Logger:     logger,
+		SampleRate: 0.5,
+	})
+	requestLogger.random = func() float64 { return 0.9 }
+	helper.WithMiddleware(requestLogger.Middleware())
+
+	for _, path := range []string{"/ok", "/missing", "/broken"} {
+		_, err := helper.Df().Uri(path).Request()
+		assert.NoError(t, err)
+	}
+	// 成功的请求被采样丢弃, 失败的请求总是记录
+	if assert.Len(t, logger.entries, 2) {
+		assert.Equal(t, LogLevelWarn, logger.entries[0].level)
+		assert.Equal(t, LogLevelError, logger.entries[1].level)
+	}
+}
+
+func TestLoggingMiddleware_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	helper := newTestHelper(t, server)
+	server.Close()
+
+	logger := &memoryLogger{}
+	helper.WithMiddleware(LoggingMiddleware(LoggingConfig{Logger: logger}))
+	_, err := helper.Df().Uri("/").Request()
+	assert.Error(t, err)
+	if assert.Len(t, logger.entries, 1) {
+		assert.Equal(t, LogLevelError, logger.entries[0].level)
+		assert.Equal(t, "connection", logger.entries[0].fields["error_category"])
+		assert.NotContains(t, logger.entries[0].fields, "status")
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	NewStdLogger(log.New(&buf, "", 0)).Log(context.Background(), LogLevelWarn, "http request", LogField{Key: "status", Value: 404})
+	assert.Equal(t, "WARN http request status=\"404\"\n", buf.String())
+}
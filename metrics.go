@@ -0,0 +1,160 @@
+package httphelper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/artisancloud/httphelper/driver/nethttp"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrorCategory 请求错误分类, 用于指标与日志
+type ErrorCategory string
+
+const (
+	ErrorCategoryTimeout    ErrorCategory = "timeout"
+	ErrorCategoryCanceled   ErrorCategory = "canceled"
+	ErrorCategoryDNS        ErrorCategory = "dns"
+	ErrorCategoryTLS        ErrorCategory = "tls"
+	ErrorCategoryConnection ErrorCategory = "connection"
+	ErrorCategoryOther      ErrorCategory = "other"
+)
+
+// ClassifyError 返回错误的分类
+func ClassifyError(err error) ErrorCategory {
+	var (
+		timeoutErr   *client.TimeoutError
+		netErr       net.Error
+		dnsErr       *net.DNSError
+		unknownCA    x509.UnknownAuthorityError
+		invalidCert  x509.CertificateInvalidError
+		hostnameErr  x509.HostnameError
+		recordHeader tls.RecordHeaderError
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorCategoryCanceled
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorCategoryTimeout
+	case errors.As(err, &dnsErr):
+		return ErrorCategoryDNS
+	case errors.As(err, &unknownCA), errors.As(err, &invalidCert), errors.As(err, &hostnameErr),
+		errors.As(err, &recordHeader), errors.Is(err, nethttp.ErrPinMismatch), isTLSAlert(err),
+		// crypto/tls 把对端发送的告警包装为 Op 为 remote error 的 net.OpError
+		errors.As(err, &opErr) && opErr.Op == "remote error":
+		return ErrorCategoryTLS
+	case errors.As(err, &opErr):
+		return ErrorCategoryConnection
+	}
+	return ErrorCategoryOther
+}
+
+// MetricLabels 指标维度, Route 为 dataflow.WithRoute 或 Dataflow.Route 设置的路由模板, 未设置时为空以避免按实际路径产生大量时间序列
+type MetricLabels struct {
+	Method string
+	Host   string
+	Route  string
+	// StatusClass 响应状态码分类, 例如 2xx, 请求出错时为 error, 进行中的请求为空
+	StatusClass string
+}
+
+// MetricsSink 指标输出接口, 可以对接自己的监控系统
+type MetricsSink interface {
+	// AddInFlight 请求开始时 delta 为 1, 结束时为 -1
+	AddInFlight(labels MetricLabels, delta float64)
+	// ObserveRequest 收到响应头或请求出错时调用, requestSize 未知时为 0
+	ObserveRequest(labels MetricLabels, duration time.Duration, requestSize int64)
+	// ObserveResponseSize 响应体读取完成或关闭时调用, size 为实际读取的字节数
+	ObserveResponseSize(labels MetricLabels, size int64)
+	ObserveError(labels MetricLabels, category ErrorCategory)
+}
+
+type MetricsConfig struct {
+	// Sink 指标输出, 默认 DefaultMetricsRegistry
+	Sink MetricsSink
+}
+
+func (c *MetricsConfig) Default() {
+	if c.Sink == nil {
+		c.Sink = DefaultMetricsRegistry
+	}
+}
+
+// MetricsMiddleware 记录请求数, 耗时, 进行中的请求数, 请求与响应大小以及错误分类
+func MetricsMiddleware(config MetricsConfig) dataflow.RequestMiddleware {
+	config.Default()
+	sink := config.Sink
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			labels := MetricLabels{
+				Method: request.Method,
+				Host:   request.URL.Host,
+			}
+			if labels.Method == "" {
+				labels.Method = http.MethodGet
+			}
+			labels.Route, _ = dataflow.RouteFromContext(request.Context())
+
+			sink.AddInFlight(labels, 1)
+			start := time.Now()
+			err := handle(request, response)
+			duration := time.Since(start)
+			sink.AddInFlight(labels, -1)
+
+			requestSize := request.ContentLength
+			if requestSize < 0 {
+				requestSize = 0
+			}
+			if err != nil {
+				labels.StatusClass = "error"
+				sink.ObserveRequest(labels, duration, requestSize)
+				sink.ObserveError(labels, ClassifyError(err))
+				return err
+			}
+
+			labels.StatusClass = fmt.Sprintf("%dxx", response.StatusCode/100)
+			sink.ObserveRequest(labels, duration, requestSize)
+			if response.Body == nil || response.Body == http.NoBody {
+				sink.ObserveResponseSize(labels, 0)
+			} else {
+				response.Body = &countingBody{ReadCloser: response.Body, done: func(size int64) {
+					sink.ObserveResponseSize(labels, size)
+				}}
+			}
+			return nil
+		}
+	}
+}
+
+// countingBody 统计读取的字节数, 读取到 EOF 或关闭时回调一次
+type countingBody struct {
+	io.ReadCloser
+	size int64
+	once sync.Once
+	done func(size int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.size) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.size) })
+	return err
+}
@@ -0,0 +1,226 @@
+package httphelper
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsRegistry MetricsConfig 未设置 Sink 时使用的指标注册表
+var DefaultMetricsRegistry = NewMetricsRegistry(MetricsRegistryConfig{})
+
+var (
+	// DefaultDurationBuckets 与 Prometheus 客户端默认的耗时分桶一致, 单位秒
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets 请求与响应大小的默认分桶, 单位字节
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+type MetricsRegistryConfig struct {
+	// Namespace 指标名前缀, 默认 httphelper_client
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+}
+
+func (c *MetricsRegistryConfig) Default() {
+	if c.Namespace == "" {
+		c.Namespace = "httphelper_client"
+	}
+	if len(c.DurationBuckets) == 0 {
+		c.DurationBuckets = DefaultDurationBuckets
+	}
+	if len(c.SizeBuckets) == 0 {
+		c.SizeBuckets = DefaultSizeBuckets
+	}
+}
+
+// MetricsRegistry 实现 MetricsSink, 在内存中聚合指标并输出 Prometheus 文本格式, 可以直接作为 /metrics 的 http.Handler
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	requests *metricFamily
+	duration *metricFamily
+	inFlight *metricFamily
+	reqSize  *metricFamily
+	resSize  *metricFamily
+	errors   *metricFamily
+}
+
+func NewMetricsRegistry(config MetricsRegistryConfig) *MetricsRegistry {
+	config.Default()
+	ns := config.Namespace
+	statusLabels := []string{"method", "host", "route", "status_class"}
+	routeLabels := []string{"method", "host", "route"}
+	return &MetricsRegistry{
+		requests: newMetricFamily(ns+"_requests_total", "Total number of HTTP requests.", "counter", statusLabels, nil),
+		duration: newMetricFamily(ns+"_request_duration_seconds", "HTTP request latency until response headers are received.", "histogram", statusLabels, config.DurationBuckets),
+		inFlight: newMetricFamily(ns+"_requests_in_flight", "Number of HTTP requests in flight.", "gauge", routeLabels, nil),
+		reqSize:  newMetricFamily(ns+"_request_size_bytes", "HTTP request body size.", "histogram", statusLabels, config.SizeBuckets),
+		resSize:  newMetricFamily(ns+"_response_size_bytes", "HTTP response body size.", "histogram", statusLabels, config.SizeBuckets),
+		errors:   newMetricFamily(ns+"_request_errors_total", "Total number of failed HTTP requests by category.", "counter", append(routeLabels, "category"), nil),
+	}
+}
+
+func (r *MetricsRegistry) AddInFlight(labels MetricLabels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight.series(labels.Method, labels.Host, labels.Route).value += delta
+}
+
+func (r *MetricsRegistry) ObserveRequest(labels MetricLabels, duration time.Duration, requestSize int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := []string{labels.Method, labels.Host, labels.Route, labels.StatusClass}
+	r.requests.series(values...).value++
+	r.duration.series(values...).observe(duration.Seconds())
+	r.reqSize.series(values...).observe(float64(requestSize))
+}
+
+func (r *MetricsRegistry) ObserveResponseSize(labels MetricLabels, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resSize.series(labels.Method, labels.Host, labels.Route, labels.StatusClass).observe(float64(size))
+}
+
+func (r *MetricsRegistry) ObserveError(labels MetricLabels, category ErrorCategory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors.series(labels.Method, labels.Host, labels.Route, string(category)).value++
+}
+
+// WritePrometheus 按 Prometheus 文本格式(0.0.4)输出所有指标
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	r.mu.Lock()
+	for _, family := range []*metricFamily{r.requests, r.duration, r.inFlight, r.reqSize, r.resSize, r.errors} {
+		family.write(buf)
+	}
+	r.mu.Unlock()
+	return buf.Flush()
+}
+
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(w)
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+	items      map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	buckets     []float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func newMetricFamily(name string, help string, typ string, labelNames []string, buckets []float64) *metricFamily {
+	return &metricFamily{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		items:      make(map[string]*metricSeries),
+	}
+}
+
+// series 返回标签值对应的时间序列, 调用方需要持有锁
+func (f *metricFamily) series(labelValues ...string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.items[key]
+	if !ok {
+		s = &metricSeries{labelValues: labelValues, buckets: f.buckets}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.items[key] = s
+	}
+	return s
+}
+
+func (s *metricSeries) observe(v float64) {
+	s.sum += v
+	s.count++
+	for i, upper := range s.buckets {
+		// 只记录所在的桶, 输出时再累加
+		if v <= upper {
+			s.counts[i]++
+			return
+		}
+	}
+}
+
+func (f *metricFamily) write(w *bufio.Writer) {
+	if len(f.items) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(f.items))
+	for key := range f.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	_, _ = w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	_, _ = w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	for _, key := range keys {
+		s := f.items[key]
+		if f.typ != "histogram" {
+			writeSample(w, f.name, f.labelNames, s.labelValues, "", s.value)
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, f.name+"_bucket", f.labelNames, s.labelValues, formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, f.name+"_bucket", f.labelNames, s.labelValues, "+Inf", float64(s.count))
+		writeSample(w, f.name+"_sum", f.labelNames, s.labelValues, "", s.sum)
+		writeSample(w, f.name+"_count", f.labelNames, s.labelValues, "", float64(s.count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames []string, labelValues []string, le string, value float64) {
+	_, _ = w.WriteString(name)
+	_ = w.WriteByte('{')
+	for i, labelName := range labelNames {
+		if i > 0 {
+			_ = w.WriteByte(',')
+		}
+		_, _ = w.WriteString(labelName + `="` + escapeLabelValue(labelValues[i]) + `"`)
+	}
+	if le != "" {
+		_, _ = w.WriteString(`,le="` + le + `"`)
+	}
+	_, _ = w.WriteString("} " + formatFloat(value) + "\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
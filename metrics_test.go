@@ -0,0 +1,95 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"github.com/artisancloud/httphelper/client"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	registry := NewMetricsRegistry(MetricsRegistryConfig{Namespace: "test"})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(MetricsMiddleware(MetricsConfig{Sink: registry}))
+
+	for _, id := range []string{"1", "2", "3"} {
+		res, err := helper.Df().WithContext(dataflow.WithRoute(context.Background(), "/users/{id}")).Method(http.MethodPost).Uri("/users/" + id).Body(strings.NewReader("body")).Request()
+		assert.NoError(t, err)
+		_, _ = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, registry.WritePrometheus(&buf))
+	output := buf.String()
+	labels := `method="POST",host="` + host + `",route="/users/{id}"`
+	assert.Contains(t, output, "# TYPE test_requests_total counter\n")
+	assert.Contains(t, output, `test_requests_total{`+labels+`,status_class="2xx"} 2`+"\n")
+	assert.Contains(t, output, `test_requests_total{`+labels+`,status_class="4xx"} 1`+"\n")
+	assert.Contains(t, output, `test_request_duration_seconds_count{`+labels+`,status_class="2xx"} 2`+"\n")
+	assert.Contains(t, output, `test_request_duration_seconds_bucket{`+labels+`,status_class="2xx",le="+Inf"} 2`+"\n")
+	assert.Contains(t, output, `test_requests_in_flight{`+labels+`} 0`+"\n")
+	assert.Contains(t, output, `test_request_size_bytes_sum{`+labels+`,status_class="2xx"} 8`+"\n")
+	assert.Contains(t, output, `test_response_size_bytes_sum{`+labels+`,status_class="2xx"} 10`+"\n")
+	assert.Contains(t, output, `test_response_size_bytes_bucket{`+labels+`,status_class="4xx",le="100"} 1`+"\n")
+	assert.NotContains(t, output, "/users/1")
+	assert.NotContains(t, output, "test_request_errors_total")
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, output, recorder.Body.String())
+}
+
+func TestMetricsMiddleware_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	helper := newTestHelper(t, server)
+	host := strings.TrimPrefix(server.URL, "http://")
+	server.Close()
+
+	registry := NewMetricsRegistry(MetricsRegistryConfig{Namespace: "test"})
+	helper.WithMiddleware(MetricsMiddleware(MetricsConfig{Sink: registry}))
+	_, err := helper.Df().Uri("/").Request()
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, registry.WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), `test_request_errors_total{method="GET",host="`+host+`",route="",category="connection"} 1`+"\n")
+	assert.Contains(t, buf.String(), `test_requests_total{method="GET",host="`+host+`",route="",status_class="error"} 1`+"\n")
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, ErrorCategoryCanceled, ClassifyError(errors.Wrap(context.Canceled, "request failed")))
+	assert.Equal(t, ErrorCategoryTimeout, ClassifyError(&client.TimeoutError{Phase: client.TimeoutPhaseConnect, Err: errors.New("i/o timeout")}))
+	assert.Equal(t, ErrorCategoryTimeout, ClassifyError(context.DeadlineExceeded))
+	assert.Equal(t, ErrorCategoryDNS, ClassifyError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x.invalid"}}))
+	assert.Equal(t, ErrorCategoryTLS, ClassifyError(errors.Wrap(x509.UnknownAuthorityError{}, "request failed")))
+	assert.Equal(t, ErrorCategoryTLS, ClassifyError(&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}))
+	// 只按错误类型判断, 不匹配错误信息
+	assert.Equal(t, ErrorCategoryOther, ClassifyError(errors.New("tls: handshake failure")))
+	assert.Equal(t, ErrorCategoryConnection, ClassifyError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.Equal(t, ErrorCategoryOther, ClassifyError(errors.New("boom")))
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabelValue("a\\b\"c\nd"))
+}
@@ -0,0 +1,288 @@
+package httphelper
+
+import (
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyByHost 按 Host 区分请求
+func KeyByHost(request *http.Request) string {
+	return request.URL.Host
+}
+
+// KeyByRoute 按 Method + Host + 路由模板区分请求, 未通过 dataflow.WithRoute 或 Dataflow.Route 设置模板时使用实际路径
+func KeyByRoute(request *http.Request) string {
+	route, ok := dataflow.RouteFromContext(request.Context())
+	if !ok {
+		route = request.URL.Path
+	}
+	return request.Method + " " + request.URL.Host + route
+}
+
+// RateLimit 令牌桶参数
+type RateLimit struct {
+	// Rate 每秒补充的令牌数
+	Rate float64
+	// Burst 令牌桶容量
+	Burst int
+}
+
+type RateLimitConfig struct {
+	RateLimit
+	// KeyFunc 令牌桶维度, 默认 KeyByHost, 可使用 KeyByRoute 或自定义函数
+	KeyFunc func(request *http.Request) string
+	// KeyLimits 为指定 key 单独设置的令牌桶参数
+	KeyLimits map[string]RateLimit
+	// IgnoreServerHints 为 true 时不根据响应中的 X-RateLimit-*, RateLimit-* 与 429 Retry-After 调整令牌桶
+	IgnoreServerHints bool
+}
+
+func (l *RateLimit) Default() {
+	if l.Rate <= 0 {
+		l.Rate = 10
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+	}
+}
+
+func (c *RateLimitConfig) Default() {
+	c.RateLimit.Default()
+	if c.KeyFunc == nil {
+		c.KeyFunc = KeyByHost
+	}
+	// 复制 KeyLimits, 不修改调用方的 map
+	keyLimits := make(map[string]RateLimit, len(c.KeyLimits))
+	for key, limit := range c.KeyLimits {
+		limit.Default()
+		keyLimits[key] = limit
+	}
+	c.KeyLimits = keyLimits
+}
+
+// rateLimitSweepInterval 清理空闲令牌桶的间隔
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter 客户端令牌桶限流器, 令牌已经补满且没有请求在使用的令牌桶会被定期清理
+type RateLimiter struct {
+	config  RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	config.Default()
+	return &RateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// RateLimitMiddleware 创建限流器并返回其中间件
+func RateLimitMiddleware(config RateLimitConfig) dataflow.RequestMiddleware {
+	return NewRateLimiter(config).Middleware()
+}
+
+// Middleware 请求前等待令牌, 直到获取成功或请求 context 结束
+func (l *RateLimiter) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			bucket := l.bucket(l.config.KeyFunc(request))
+			defer l.release(bucket)
+			if err := l.wait(request, bucket); err != nil {
+				return err
+			}
+
+			err := handle(request, response)
+			if err == nil && !l.config.IgnoreServerHints {
+				l.applyHints(bucket, response)
+			}
+			return err
+		}
+	}
+}
+
+// bucket 返回 key 的令牌桶, 使用完后需要调用 release
+func (l *RateLimiter) bucket(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		limit, ok := l.config.KeyLimits[key]
+		if !ok {
+			limit = l.config.RateLimit
+		}
+		bucket = &tokenBucket{
+			rate:   limit.Rate,
+			burst:  float64(limit.Burst),
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+		l.buckets[key] = bucket
+	}
+	bucket.refs++
+	return bucket
+}
+
+func (l *RateLimiter) release(bucket *tokenBucket) {
+	l.mu.Lock()
+	bucket.refs--
+	l.mu.Unlock()
+}
+
+// sweep 删除没有请求在使用且令牌已经补满的令牌桶, 这些令牌桶与新建的令牌桶等价
+func (l *RateLimiter) sweep(now time.Time) {
+	l.swept = now
+	for key, bucket := range l.buckets {
+		if bucket.refs > 0 {
+			continue
+		}
+		bucket.mu.Lock()
+		bucket.advance(now)
+		idle := bucket.tokens >= bucket.burst && !bucket.last.After(now)
+		bucket.mu.Unlock()
+		if idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *RateLimiter) wait(request *http.Request, bucket *tokenBucket) error {
+	ctx := request.Context()
+	bucket.mu.Lock()
+	wait := bucket.reserve(l.now())
+	bucket.mu.Unlock()
+
+	if err := sleepContext(ctx, wait); err != nil {
+		bucket.mu.Lock()
+		bucket.cancel()
+		bucket.mu.Unlock()
+		return errors.Wrap(err, "rate limit wait interrupted")
+	}
+	return nil
+}
+
+func (l *RateLimiter) applyHints(bucket *tokenBucket, response *http.Response) {
+	now := l.now()
+	remaining, reset, ok := parseRateLimitHeaders(response.Header, now)
+	if response.StatusCode == http.StatusTooManyRequests {
+		if retryAfter, hasRetryAfter := parseRetryAfter(response.Header.Get("Retry-After"), now); hasRetryAfter {
+			remaining, reset, ok = 0, now.Add(retryAfter), true
+		}
+	}
+	if !ok {
+		return
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	bucket.advance(now)
+	if remaining <= 0 {
+		bucket.block(reset)
+	} else if float64(remaining) < bucket.tokens {
+		bucket.tokens = float64(remaining)
+	}
+}
+
+// parseRateLimitHeaders 解析服务端返回的剩余配额与重置时间.
+// 支持 X-RateLimit-Remaining/X-RateLimit-Reset(秒数或 Unix 时间戳), RateLimit-Remaining/RateLimit-Reset
+// 以及 RateLimit: limit=100, remaining=0, reset=5 格式
+func parseRateLimitHeaders(header http.Header, now time.Time) (remaining int, reset time.Time, ok bool) {
+	remainingValue, resetValue := header.Get("RateLimit-Remaining"), header.Get("RateLimit-Reset")
+	if remainingValue == "" {
+		remainingValue, resetValue = header.Get("X-RateLimit-Remaining"), header.Get("X-RateLimit-Reset")
+	}
+	if remainingValue == "" {
+		for _, item := range strings.Split(header.Get("RateLimit"), ",") {
+			kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "remaining", "r":
+				remainingValue = kv[1]
+			case "reset", "t":
+				resetValue = kv[1]
+			}
+		}
+	}
+	if remainingValue == "" {
+		return 0, time.Time{}, false
+	}
+
+	remaining, err := strconv.Atoi(strings.TrimSpace(remainingValue))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	reset = now
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(resetValue), 64); err == nil && seconds > 0 {
+		// 超过一年的数值视为 Unix 时间戳
+		if seconds > 365*24*3600 {
+			reset = time.Unix(int64(seconds), 0)
+		} else {
+			reset = now.Add(time.Duration(seconds * float64(time.Second)))
+		}
+	}
+	return remaining, reset, true
+}
+
+// tokenBucket 令牌桶, tokens 可以为负数表示已被等待中的请求预占
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	// last 上次补充令牌的时间, 被服务端限流时会被推迟到重置时间
+	last time.Time
+	// refs 正在使用该令牌桶的请求数, 由 RateLimiter.mu 保护
+	refs int
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserve 预占一个令牌并返回需要等待的时长
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.advance(now)
+	b.tokens--
+	readyAt := now
+	if b.last.After(now) {
+		readyAt = b.last
+	}
+	if b.tokens < 0 {
+		readyAt = readyAt.Add(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+	return readyAt.Sub(now)
+}
+
+// cancel 归还未使用的令牌
+func (b *tokenBucket) cancel() {
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// block 在 until 之前不再补充令牌
+func (b *tokenBucket) block(until time.Time) {
+	if !until.After(b.last) {
+		return
+	}
+	b.tokens = math.Min(b.tokens, 0)
+	b.last = until
+}
@@ -0,0 +1,141 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RateLimitMiddleware(RateLimitConfig{
+		RateLimit: RateLimit{Rate: 20, Burst: 1},
+	}))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+		assert.NoError(t, err)
+	}
+	// 第一个请求消耗桶内令牌, 后两个各等待 50ms
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestRateLimiter_ContextExpired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RateLimitMiddleware(RateLimitConfig{
+		RateLimit: RateLimit{Rate: 0.1, Burst: 1},
+	}))
+
+	_, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = helper.Df().WithContext(ctx).Method(http.MethodGet).Uri("/").Request()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRateLimiter_ServerHints(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{
+		RateLimit: RateLimit{Rate: 100, Burst: 10},
+	})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	bucket := limiter.bucket("api.example.com")
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	response.Header.Set("X-RateLimit-Remaining", "0")
+	response.Header.Set("X-RateLimit-Reset", "2")
+	limiter.applyHints(bucket, response)
+
+	bucket.mu.Lock()
+	wait := bucket.reserve(now)
+	bucket.mu.Unlock()
+	assert.Equal(t, 2*time.Second+10*time.Millisecond, wait)
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	header.Set("RateLimit", "limit=100, remaining=5, reset=30")
+	remaining, reset, ok := parseRateLimitHeaders(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, 5, remaining)
+	assert.Equal(t, now.Add(30*time.Second), reset)
+
+	header = http.Header{}
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", "1700000060")
+	remaining, reset, ok = parseRateLimitHeaders(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, now.Add(time.Minute), reset)
+
+	_, _, ok = parseRateLimitHeaders(http.Header{}, now)
+	assert.False(t, ok)
+}
+
+func TestKeyByRoute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var keys []string
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RateLimitMiddleware(RateLimitConfig{
+		KeyFunc: func(request *http.Request) string {
+			key := KeyByRoute(request)
+			keys = append(keys, key)
+			return key
+		},
+	}))
+
+	_, err := helper.Df().WithContext(dataflow.WithRoute(context.Background(), "/users/{id}")).Method(http.MethodGet).Uri("/users/1").Request()
+	assert.NoError(t, err)
+	_, err = helper.Df().Method(http.MethodGet).Uri("/users/2").Request()
+	assert.NoError(t, err)
+
+	host := server.Listener.Addr().String()
+	assert.Equal(t, []string{"GET " + host + "/users/{id}", "GET " + host + "/users/2"}, keys)
+}
+
+func TestRateLimitConfig_KeyLimits(t *testing.T) {
+	keyLimits := map[string]RateLimit{"api.example.com": {Rate: 5}}
+	config := RateLimitConfig{KeyLimits: keyLimits}
+	config.Default()
+	assert.Equal(t, RateLimit{Rate: 5, Burst: 5}, config.KeyLimits["api.example.com"])
+	// 不修改调用方的 map
+	assert.Equal(t, RateLimit{Rate: 5}, keyLimits["api.example.com"])
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := NewRateLimiter(RateLimitConfig{RateLimit: RateLimit{Rate: 1, Burst: 2}})
+	limiter.now = clock.Now
+
+	idle := limiter.bucket("idle")
+	limiter.release(idle)
+	busy := limiter.bucket("busy")
+	drained := limiter.bucket("drained")
+	limiter.release(drained)
+	drained.tokens = -1000
+
+	// 令牌补满且没有请求使用的令牌桶被清理
+	clock.Add(2 * time.Minute)
+	limiter.release(limiter.bucket("new"))
+	assert.NotContains(t, limiter.buckets, "idle")
+	assert.Contains(t, limiter.buckets, "busy")
+	assert.Contains(t, limiter.buckets, "drained")
+	limiter.release(busy)
+}
@@ -0,0 +1,225 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 重试策略, 零值字段会在 Default 中填充默认值
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数(包含首次请求), 默认 3
+	MaxAttempts int
+	// MaxElapsed 从首次请求开始计算的重试总耗时上限, 0 表示不限制
+	MaxElapsed time.Duration
+	// InitialInterval 首次重试前的等待时长, 默认 100ms
+	InitialInterval time.Duration
+	// MaxInterval 单次等待时长上限, 默认 10s, Retry-After 超过该值时不再重试, 直接返回该响应
+	MaxInterval time.Duration
+	// Multiplier 每次重试等待时长的增长倍数, 默认 2
+	Multiplier float64
+	// Jitter 等待时长的随机抖动比例, 取值 (0, 1], 默认 0.2, 小于 0 表示不抖动
+	Jitter float64
+	// RetryStatusCodes 需要重试的响应状态码, 默认 429, 502, 503, 504
+	RetryStatusCodes []int
+	// RetryOnError 判断请求错误是否需要重试, 默认除取消外的错误都会重试(包括 Dataflow.Timeout 设置的单次请求超时),
+	// 请求 context 结束后不会再重试
+	RetryOnError func(err error) bool
+	// IgnoreRetryAfter 为 true 时不使用响应头 Retry-After 作为等待时长
+	IgnoreRetryAfter bool
+	// OnRetry 每次重试前回调, attempt 为即将发起的第几次尝试
+	OnRetry func(attempt int, wait time.Duration, request *http.Request, response *http.Response, err error)
+}
+
+func (p *RetryPolicy) Default() {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = 100 * time.Millisecond
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = 10 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter == 0 {
+		p.Jitter = 0.2
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	if p.RetryStatusCodes == nil {
+		p.RetryStatusCodes = []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+	if p.RetryOnError == nil {
+		p.RetryOnError = defaultRetryOnError
+	}
+}
+
+func defaultRetryOnError(err error) bool {
+	return !errors.Is(err, context.Canceled)
+}
+
+func (p *RetryPolicy) shouldRetryStatus(statusCode int) bool {
+	for _, code := range p.RetryStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 计算第 retry 次重试(从 1 开始)的等待时长
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(retry-1))
+	if interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		interval = interval * (1 + p.Jitter*(rand.Float64()*2-1))
+	}
+	return time.Duration(interval)
+}
+
+// RetryMiddleware 在网络错误或指定状态码时重新执行请求.
+// 请求体必须可以通过 request.GetBody 重放(Dataflow.Body 对 bytes/strings reader 会自动设置), 否则只会发送一次.
+// 重试次数耗尽时返回最后一次的响应或错误.
+func RetryMiddleware(policy RetryPolicy) dataflow.RequestMiddleware {
+	policy.Default()
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) (err error) {
+			ctx := request.Context()
+			start := time.Now()
+			replayable := isReplayableRequest(request)
+
+			attemptRequest := request
+			attempt := 1
+			for ; ; attempt++ {
+				*response = http.Response{}
+				err = handle(attemptRequest, response)
+
+				if attempt >= policy.MaxAttempts || !replayable || ctx.Err() != nil {
+					break
+				}
+				if err != nil {
+					if !policy.RetryOnError(err) {
+						break
+					}
+				} else if !policy.shouldRetryStatus(response.StatusCode) {
+					break
+				}
+
+				wait := policy.backoff(attempt)
+				if err == nil && !policy.IgnoreRetryAfter {
+					if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+						if retryAfter > policy.MaxInterval {
+							break
+						}
+						wait = retryAfter
+					}
+				}
+				if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+					break
+				}
+
+				if policy.OnRetry != nil {
+					policy.OnRetry(attempt+1, wait, request, response, err)
+				}
+				recordRetry(ctx, attempt+1, wait, err)
+				if err == nil {
+					discardResponseBody(response)
+				}
+
+				if waitErr := sleepContext(ctx, wait); waitErr != nil {
+					return errors.Wrap(waitErr, "retry interrupted")
+				}
+
+				attemptRequest, err = rewindRequest(request)
+				if err != nil {
+					return err
+				}
+			}
+
+			if err != nil && attempt > 1 {
+				return errors.Wrapf(err, "retry exhausted after %d attempts", attempt)
+			}
+			return err
+		}
+	}
+}
+
+// isReplayableRequest 判断请求体是否可以重复发送
+func isReplayableRequest(request *http.Request) bool {
+	return request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+}
+
+// rewindRequest 复制请求并通过 GetBody 重置请求体
+func rewindRequest(request *http.Request) (*http.Request, error) {
+	newRequest := request.Clone(request.Context())
+	if request.Body == nil || request.Body == http.NoBody {
+		return newRequest, nil
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rewind request body")
+	}
+	newRequest.Body = body
+	return newRequest, nil
+}
+
+// discardResponseBody 读取少量剩余数据后关闭响应体, 以便连接可以复用
+func discardResponseBody(response *http.Response) {
+	if response == nil || response.Body == nil {
+		return
+	}
+	_, _ = io.CopyN(io.Discard, response.Body, 4096)
+	_ = response.Body.Close()
+}
+
+// parseRetryAfter 解析 Retry-After, 支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	wait := date.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
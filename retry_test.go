@@ -0,0 +1,133 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryMiddleware_StatusCode(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "payload", string(body))
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RetryMiddleware(RetryPolicy{
+		InitialInterval: time.Millisecond,
+	}))
+
+	res, err := helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("payload")).Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRetryMiddleware_Exhausted(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RetryMiddleware(RetryPolicy{
+		MaxAttempts:     2,
+		InitialInterval: time.Millisecond,
+	}))
+
+	res, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRetryMiddleware_NonReplayableBody(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RetryMiddleware(RetryPolicy{
+		InitialInterval: time.Millisecond,
+	}))
+
+	// io.MultiReader 无法被 Dataflow.Body 识别, 不会设置 GetBody
+	body := io.MultiReader(strings.NewReader("payload"))
+	res, err := helper.Df().Method(http.MethodPost).Uri("/").Body(body).Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryMiddleware_ContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RetryMiddleware(RetryPolicy{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := helper.Df().WithContext(ctx).Method(http.MethodGet).Uri("/").Request()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRetryMiddleware_RetryAfterTooLong(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(RetryMiddleware(RetryPolicy{MaxInterval: time.Second}))
+
+	// Retry-After 超过 MaxInterval 时直接返回响应
+	start := time.Now()
+	res, err := helper.Df().Method(http.MethodGet).Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	wait, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, wait)
+
+	wait, ok = parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,8 @@
+//go:build !go1.21
+
+package httphelper
+
+// isTLSAlert go1.21 之前没有 tls.AlertError 与 tls.CertificateVerificationError, 只能依赖 x509 错误类型判断
+func isTLSAlert(err error) bool {
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build go1.21
+
+package httphelper
+
+import (
+	"crypto/tls"
+	"github.com/pkg/errors"
+)
+
+// isTLSAlert 判断 tls 告警与证书验证错误
+func isTLSAlert(err error) bool {
+	var (
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+	)
+	return errors.As(err, &alertErr) || errors.As(err, &verifyErr)
+}
@@ -0,0 +1,15 @@
+//go:build go1.21
+
+package httphelper
+
+import (
+	"crypto/tls"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClassifyError_TLS(t *testing.T) {
+	assert.Equal(t, ErrorCategoryTLS, ClassifyError(errors.Wrap(tls.AlertError(42), "request failed")))
+	assert.Equal(t, ErrorCategoryTLS, ClassifyError(&tls.CertificateVerificationError{Err: errors.New("expired")}))
+}
@@ -0,0 +1,345 @@
+package httphelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Token 访问令牌, ExpiresAt 为零值表示不会过期
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+}
+
+// Valid 判断令牌在 now 之后的 leeway 时间内是否仍然有效
+func (t *Token) Valid(now time.Time, leeway time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.ExpiresAt.IsZero() || now.Add(leeway).Before(t.ExpiresAt)
+}
+
+// TokenProvider 从令牌接口获取新的访问令牌
+type TokenProvider interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenProviderFunc 函数形式的 TokenProvider
+type TokenProviderFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+type TokenConfig struct {
+	// Provider 获取新令牌, 必须设置
+	Provider TokenProvider
+	// Cache 令牌缓存, 默认进程内缓存, 多进程共享时使用 FileTokenCache 等实现
+	Cache TokenCache
+	// CacheKey 令牌在缓存中的 key, 多个应用共用一个缓存时需要区分, 默认 access_token
+	CacheKey string
+	// RefreshBefore 在令牌过期前多久刷新, 默认 1 分钟
+	RefreshBefore time.Duration
+	// FetchTimeout 读取缓存与请求令牌接口的超时, 默认 30s
+	FetchTimeout time.Duration
+	// Inject 把令牌写入请求, 默认写入 Authorization 请求头, 见 InjectTokenHeader 与 InjectTokenQuery
+	Inject func(request *http.Request, token *Token)
+	// InvalidStatusCodes 表示令牌失效的状态码, 默认 401
+	InvalidStatusCodes []int
+	// InvalidErrCodes 表示令牌失效的 JSON 响应体错误码(例如微信的 40001, 40014, 42001), 设置后会读取响应体检查 ErrCodeField 字段
+	InvalidErrCodes []int
+	// ErrCodeField 错误码字段名, 默认 errcode
+	ErrCodeField string
+	// IsTokenInvalid 自定义令牌失效判断, 设置后代替以上规则, body 为响应体开头最多 MaxInspectBody 字节
+	IsTokenInvalid func(response *http.Response, body []byte) bool
+	// MaxInspectBody 检查错误码时最多读取的响应体字节数, 默认 64KB
+	MaxInspectBody int
+	// OnCacheError 读写缓存出错时回调, 缓存出错不影响请求
+	OnCacheError func(err error)
+}
+
+func (c *TokenConfig) Default() {
+	if c.Cache == nil {
+		c.Cache = NewMemoryTokenCache()
+	}
+	if c.CacheKey == "" {
+		c.CacheKey = "access_token"
+	}
+	if c.RefreshBefore == 0 {
+		c.RefreshBefore = time.Minute
+	}
+	if c.FetchTimeout <= 0 {
+		c.FetchTimeout = 30 * time.Second
+	}
+	if c.Inject == nil {
+		c.Inject = InjectTokenHeader("Authorization", "")
+	}
+	if c.InvalidStatusCodes == nil {
+		c.InvalidStatusCodes = []int{http.StatusUnauthorized}
+	}
+	if c.ErrCodeField == "" {
+		c.ErrCodeField = "errcode"
+	}
+	if c.MaxInspectBody <= 0 {
+		c.MaxInspectBody = 64 << 10
+	}
+}
+
+// InjectTokenHeader 把令牌写入请求头, prefix 为空时使用令牌的 TokenType, 默认 Bearer
+func InjectTokenHeader(name string, prefix string) func(request *http.Request, token *Token) {
+	return func(request *http.Request, token *Token) {
+		value := prefix
+		if value == "" {
+			value = token.TokenType
+		}
+		if value == "" {
+			value = "Bearer"
+		}
+		request.Header.Set(name, value+" "+token.AccessToken)
+	}
+}
+
+// InjectTokenQuery 把令牌写入查询参数, 例如微信接口的 access_token
+func InjectTokenQuery(name string) func(request *http.Request, token *Token) {
+	return func(request *http.Request, token *Token) {
+		query := request.URL.Query()
+		query.Set(name, token.AccessToken)
+		request.URL.RawQuery = query.Encode()
+	}
+}
+
+// TokenManager 缓存访问令牌直到临近过期, 并发刷新时只请求一次令牌接口
+type TokenManager struct {
+	config TokenConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	current *Token
+	call    *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func NewTokenManager(config TokenConfig) *TokenManager {
+	config.Default()
+	return &TokenManager{config: config, now: time.Now}
+}
+
+// TokenMiddleware 创建令牌管理器并返回其中间件
+func TokenMiddleware(config TokenConfig) dataflow.RequestMiddleware {
+	return NewTokenManager(config).Middleware()
+}
+
+// Token 返回有效的令牌, 依次查找本地副本, 共享缓存, 都没有时刷新
+func (m *TokenManager) Token(ctx context.Context) (*Token, error) {
+	now := m.now()
+	m.mu.Lock()
+	current := m.current
+	m.mu.Unlock()
+	if current.Valid(now, m.config.RefreshBefore) {
+		return current, nil
+	}
+
+	// 其他进程可能已经刷新了令牌
+	cached, err := m.config.Cache.Get(ctx, m.config.CacheKey)
+	if err != nil {
+		m.cacheError(err)
+	} else if cached.Valid(now, m.config.RefreshBefore) {
+		m.mu.Lock()
+		m.current = cached
+		m.mu.Unlock()
+		return cached, nil
+	}
+	return m.refresh(ctx, nil)
+}
+
+// Invalidate 丢弃失效的令牌, 只有当前令牌仍是 token 时才生效, 避免并发请求重复刷新
+func (m *TokenManager) Invalidate(ctx context.Context, token *Token) {
+	m.mu.Lock()
+	if m.current != nil && m.current.AccessToken == token.AccessToken {
+		m.current = nil
+	}
+	m.mu.Unlock()
+
+	cached, err := m.config.Cache.Get(ctx, m.config.CacheKey)
+	if err != nil {
+		m.cacheError(err)
+		return
+	}
+	if cached != nil && cached.AccessToken == token.AccessToken {
+		if err = m.config.Cache.Delete(ctx, m.config.CacheKey); err != nil {
+			m.cacheError(err)
+		}
+	}
+}
+
+// refresh 同时只发起一次刷新, stale 不为 nil 时表示强制替换该令牌
+func (m *TokenManager) refresh(ctx context.Context, stale *Token) (*Token, error) {
+	m.mu.Lock()
+	// 其他请求已经刷新过失效的令牌
+	if stale != nil && m.current != nil && m.current.AccessToken != stale.AccessToken {
+		current := m.current
+		m.mu.Unlock()
+		return current, nil
+	}
+	call := m.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		m.call = call
+		// 刷新结果会被其他请求共享, 不受当前请求取消的影响, 只受 FetchTimeout 限制
+		go m.fetch(detachedContext{parent: ctx}, call, stale)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "wait for token interrupted")
+	}
+}
+
+// fetch 优先使用其他进程写入共享缓存的新令牌, 没有时才请求令牌接口, 避免多个进程轮流刷新使对方的令牌失效
+func (m *TokenManager) fetch(ctx context.Context, call *tokenCall, stale *Token) {
+	ctx, cancel := context.WithTimeout(ctx, m.config.FetchTimeout)
+	defer cancel()
+	defer func() {
+		m.mu.Lock()
+		if call.err == nil {
+			m.current = call.token
+		}
+		m.call = nil
+		m.mu.Unlock()
+		close(call.done)
+	}()
+
+	cached, err := m.config.Cache.Get(ctx, m.config.CacheKey)
+	if err != nil {
+		m.cacheError(err)
+	} else if cached.Valid(m.now(), m.config.RefreshBefore) &&
+		(stale == nil || cached.AccessToken != stale.AccessToken) {
+		call.token = cached
+		return
+	}
+
+	token, err := m.config.Provider.Token(ctx)
+	if err == nil && (token == nil || token.AccessToken == "") {
+		err = errors.New("token provider returned empty token")
+	}
+	if err != nil {
+		call.err = errors.Wrap(err, "failed to get token")
+		return
+	}
+	call.token = token
+	if err = m.config.Cache.Set(ctx, m.config.CacheKey, token); err != nil {
+		m.cacheError(err)
+	}
+}
+
+func (m *TokenManager) cacheError(err error) {
+	if m.config.OnCacheError != nil {
+		m.config.OnCacheError(err)
+	}
+}
+
+// Middleware 为请求写入令牌, 服务端返回令牌失效时使令牌失效并强制刷新后重试一次.
+// 只有请求体可以通过 request.GetBody 重放时才会重试, 否则直接返回失效的响应.
+// 刷新失败时关闭失效的响应并返回错误.
+func (m *TokenManager) Middleware() dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			ctx := request.Context()
+			token, err := m.Token(ctx)
+			if err != nil {
+				return err
+			}
+			authorized := request.Clone(ctx)
+			m.config.Inject(authorized, token)
+			if err = handle(authorized, response); err != nil {
+				return err
+			}
+			if !m.invalid(response) {
+				return nil
+			}
+
+			// 无法重试时也要让后续请求使用新令牌
+			m.Invalidate(ctx, token)
+			if !isReplayableRequest(request) {
+				return nil
+			}
+			discardResponseBody(response)
+			*response = http.Response{}
+			if token, err = m.refresh(ctx, token); err != nil {
+				return err
+			}
+			authorized, err = rewindRequest(request)
+			if err != nil {
+				return err
+			}
+			m.config.Inject(authorized, token)
+			return handle(authorized, response)
+		}
+	}
+}
+
+// invalid 判断响应是否表示令牌失效, 读取过的响应体会放回 response.Body
+func (m *TokenManager) invalid(response *http.Response) bool {
+	if m.config.IsTokenInvalid == nil {
+		for _, code := range m.config.InvalidStatusCodes {
+			if response.StatusCode == code {
+				return true
+			}
+		}
+		if len(m.config.InvalidErrCodes) == 0 {
+			return false
+		}
+	}
+
+	var body []byte
+	if response.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(response.Body, int64(m.config.MaxInspectBody)))
+		response.Body = &prefixBody{
+			Reader: io.MultiReader(bytes.NewReader(body), response.Body),
+			Closer: response.Body,
+		}
+		if err != nil {
+			return false
+		}
+	}
+	if m.config.IsTokenInvalid != nil {
+		return m.config.IsTokenInvalid(response, body)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return false
+	}
+	raw, ok := fields[m.config.ErrCodeField]
+	if !ok {
+		return false
+	}
+	var code json.Number
+	if json.Unmarshal(raw, &code) != nil {
+		return false
+	}
+	for _, invalidCode := range m.config.InvalidErrCodes {
+		if code.String() == fmt.Sprint(invalidCode) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package httphelper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TokenCache 令牌缓存, 多个进程共享令牌时使用 FileTokenCache 或自己实现的 Redis 等缓存, 未找到时返回 nil, nil
+type TokenCache interface {
+	Get(ctx context.Context, key string) (*Token, error)
+	Set(ctx context.Context, key string, token *Token) error
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryTokenCache 进程内的令牌缓存
+type MemoryTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+func NewMemoryTokenCache() *MemoryTokenCache {
+	return &MemoryTokenCache{tokens: make(map[string]Token)}
+}
+
+func (c *MemoryTokenCache) Get(_ context.Context, key string) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (c *MemoryTokenCache) Set(_ context.Context, key string, token *Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = *token
+	return nil
+}
+
+func (c *MemoryTokenCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, key)
+	return nil
+}
+
+// FileTokenCache 每个 key 保存为目录下的一个 JSON 文件, 可以在同一台机器的多个进程间共享
+type FileTokenCache struct {
+	dir string
+}
+
+func NewFileTokenCache(dir string) (*FileTokenCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "create token cache dir failed")
+	}
+	return &FileTokenCache{dir: dir}, nil
+}
+
+func (c *FileTokenCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *FileTokenCache) Get(_ context.Context, key string) (*Token, error) {
+	data, err := os.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read token file failed")
+	}
+	token := new(Token)
+	if err = json.Unmarshal(data, token); err != nil {
+		return nil, errors.Wrap(err, "decode token file failed")
+	}
+	return token, nil
+}
+
+// Set 先写入临时文件再替换, 其他进程不会读到写了一半的文件
+func (c *FileTokenCache) Set(_ context.Context, key string, token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "encode token failed")
+	}
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create token file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "write token file failed")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "write token file failed")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), c.path(key)), "replace token file failed")
+}
+
+func (c *FileTokenCache) Delete(_ context.Context, key string) error {
+	err := os.Remove(c.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "delete token file failed")
+	}
+	return nil
+}
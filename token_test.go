@@ -0,0 +1,294 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTokenProvider 每次返回 token-<序号>, 可以通过 release 控制返回时机
+func countingTokenProvider(calls *int32, release chan struct{}, expiresIn time.Duration) TokenProvider {
+	return TokenProviderFunc(func(ctx context.Context) (*Token, error) {
+		n := atomic.AddInt32(calls, 1)
+		if release != nil {
+			<-release
+		}
+		return &Token{AccessToken: "token-" + strconv.Itoa(int(n)), ExpiresAt: time.Now().Add(expiresIn)}, nil
+	})
+}
+
+func TestTokenMiddleware_Header(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TokenMiddleware(TokenConfig{Provider: countingTokenProvider(&calls, release, time.Hour)}))
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := helper.Df().Uri("/").Request()
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(res.Body)
+				assert.Equal(t, "Bearer token-1", string(body))
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	_, err := helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestTokenMiddleware_RefreshBeforeExpiry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Query().Get("access_token")))
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Now()}
+	var calls int32
+	provider := TokenProviderFunc(func(ctx context.Context) (*Token, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return &Token{AccessToken: "token-" + strconv.Itoa(int(n)), ExpiresAt: clock.Now().Add(2 * time.Hour)}, nil
+	})
+	helper := newTestHelper(t, server)
+	manager := NewTokenManager(TokenConfig{
+		Provider:      provider,
+		Inject:        InjectTokenQuery("access_token"),
+		RefreshBefore: 5 * time.Minute,
+	})
+	manager.now = clock.Now
+	helper.WithMiddleware(manager.Middleware())
+
+	get := func() string {
+		res, err := helper.Df().Uri("/cgi-bin/user/get").Query("next_openid", "x").Request()
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+	assert.Equal(t, "token-1", get())
+	clock.Add(time.Hour)
+	assert.Equal(t, "token-1", get())
+	clock.Add(56 * time.Minute)
+	assert.Equal(t, "token-2", get())
+}
+
+func TestTokenMiddleware_InvalidStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	var calls int32
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TokenMiddleware(TokenConfig{Provider: countingTokenProvider(&calls, nil, time.Hour)}))
+
+	res, err := helper.Df().Method(http.MethodPost).Uri("/").Body(strings.NewReader("payload")).Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTokenMiddleware_InvalidErrCode(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("access_token") != "token-3" {
+			_, _ = w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	var calls int32
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TokenMiddleware(TokenConfig{
+		Provider:        countingTokenProvider(&calls, nil, time.Hour),
+		Inject:          InjectTokenQuery("access_token"),
+		InvalidErrCodes: []int{40001, 40014, 42001},
+	}))
+
+	// 只重试一次, 仍然失效时返回服务端的响应
+	res, err := helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, `{"errcode":40001,"errmsg":"invalid credential"}`, string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	res, err = helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, `{"errcode":0,"errmsg":"ok"}`, string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestTokenMiddleware_SharedCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	cache, err := NewFileTokenCache(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// 两个管理器模拟两个进程
+	var calls int32
+	config := TokenConfig{Provider: countingTokenProvider(&calls, nil, time.Hour), Cache: cache, CacheKey: "app-1"}
+	first := newTestHelper(t, server)
+	first.WithMiddleware(TokenMiddleware(config))
+	second := newTestHelper(t, server)
+	second.WithMiddleware(TokenMiddleware(config))
+
+	for _, helper := range []Helper{first, second} {
+		res, err := helper.Df().Uri("/").Request()
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "Bearer token-1", string(body))
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	token, err := cache.Get(context.Background(), "app-1")
+	if assert.NoError(t, err) && assert.NotNil(t, token) {
+		assert.Equal(t, "token-1", token.AccessToken)
+	}
+	assert.NoError(t, cache.Delete(context.Background(), "app-1"))
+	token, err = cache.Get(context.Background(), "app-1")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+}
+
+func TestTokenMiddleware_SharedCacheRefresh(t *testing.T) {
+	var calls int32
+	provider := countingTokenProvider(&calls, nil, time.Hour)
+	// 服务端只接受最新签发的令牌
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-"+strconv.Itoa(int(atomic.LoadInt32(&calls))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	cache, err := NewFileTokenCache(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+	config := TokenConfig{Provider: provider, Cache: cache}
+	first := NewTokenManager(config)
+	second := NewTokenManager(config)
+
+	token, err := first.Token(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token-1", token.AccessToken)
+	}
+	// 另一个进程刷新令牌, 使 token-1 失效
+	second.Invalidate(context.Background(), token)
+	token, err = second.refresh(context.Background(), token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token-2", token.AccessToken)
+	}
+
+	// 第一个进程收到 401 后使用共享缓存中的 token-2, 不再请求令牌接口
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(first.Middleware())
+	res, err := helper.Df().Uri("/").Request()
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "Bearer token-2", string(body))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	cached, err := cache.Get(context.Background(), "access_token")
+	if assert.NoError(t, err) && assert.NotNil(t, cached) {
+		assert.Equal(t, "token-2", cached.AccessToken)
+	}
+}
+
+func TestTokenMiddleware_InvalidNonReplayable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var calls int32
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TokenMiddleware(TokenConfig{Provider: countingTokenProvider(&calls, nil, time.Hour)}))
+
+	// 请求体无法重放时不重试, 但失效的令牌不会再被使用
+	body := io.MultiReader(strings.NewReader("payload"))
+	res, err := helper.Df().Method(http.MethodPost).Uri("/").Body(body).Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	res, err = helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTokenMiddleware_FetchTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	var calls int32
+	provider := TokenProviderFunc(func(ctx context.Context) (*Token, error) {
+		// 第一次请求令牌接口一直挂起直到超时
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &Token{AccessToken: "token-2", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TokenMiddleware(TokenConfig{Provider: provider, FetchTimeout: 50 * time.Millisecond}))
+
+	_, err := helper.Df().Uri("/").Request()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	res, err := helper.Df().Uri("/").Request()
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "Bearer token-2", string(body))
+	}
+}
@@ -0,0 +1,127 @@
+package httphelper
+
+import (
+	"crypto/tls"
+	"github.com/artisancloud/httphelper/dataflow"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type TraceConfig struct {
+	// OnTiming 请求结束(收到响应头或出错)时回调, 可用于记录慢请求
+	OnTiming func(request *http.Request, response *http.Response, timing dataflow.Timing, err error)
+}
+
+// TraceMiddleware 通过 httptrace 记录 DNS, 建立连接, tls 握手, 首字节等各阶段耗时,
+// 结果可以通过 dataflow.ResponseTiming 或 TraceConfig.OnTiming 获取
+func TraceMiddleware(config TraceConfig) dataflow.RequestMiddleware {
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			recorder := &timingRecorder{timing: dataflow.Timing{Start: time.Now()}}
+			timing := new(dataflow.Timing)
+			ctx := dataflow.WithTiming(request.Context(), timing)
+			ctx = httptrace.WithClientTrace(ctx, recorder.clientTrace())
+
+			err := handle(request.WithContext(ctx), response)
+
+			// 只在请求结束后写入 timing, 读取方不会与 httptrace 回调并发
+			*timing = recorder.finish()
+			if config.OnTiming != nil {
+				config.OnTiming(request, response, *timing, err)
+			}
+			return err
+		}
+	}
+}
+
+// timingRecorder 汇总 httptrace 回调, 回调可能来自不同的 goroutine
+type timingRecorder struct {
+	mu     sync.Mutex
+	timing dataflow.Timing
+
+	dnsStart, connectStart, tlsStart, wrote time.Time
+}
+
+func (r *timingRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			// 重定向或重试时重新记录连接阶段
+			r.timing.DNS, r.timing.Connect, r.timing.TLSHandshake = 0, 0, 0
+			r.connectStart = time.Time{}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.DNS = time.Since(r.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			// 同时尝试多个地址时从第一次开始计算
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil {
+				r.timing.Connect = time.Since(r.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.TLSHandshake = time.Since(r.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.ConnReused = info.Reused
+			r.timing.ConnIdleTime = info.IdleTime
+			if info.Conn != nil {
+				if addr := info.Conn.RemoteAddr(); addr != nil {
+					r.timing.RemoteAddr = addr.String()
+				}
+				if addr := info.Conn.LocalAddr(); addr != nil {
+					r.timing.LocalAddr = addr.String()
+				}
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.wrote = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			now := time.Now()
+			r.timing.TimeToFirstByte = now.Sub(r.timing.Start)
+			if !r.wrote.IsZero() {
+				r.timing.ServerProcessing = now.Sub(r.wrote)
+			}
+		},
+	}
+}
+
+func (r *timingRecorder) finish() dataflow.Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timing.Total = time.Since(r.timing.Start)
+	return r.timing
+}
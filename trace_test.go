@@ -0,0 +1,75 @@
+package httphelper
+
+import (
+	"github.com/artisancloud/httphelper/client"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var timings []dataflow.Timing
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TraceMiddleware(TraceConfig{
+		OnTiming: func(request *http.Request, response *http.Response, timing dataflow.Timing, err error) {
+			assert.NoError(t, err)
+			timings = append(timings, timing)
+		},
+	}))
+
+	for i := 0; i < 2; i++ {
+		res, err := helper.Df().Uri("/").Request()
+		assert.NoError(t, err)
+		_, _ = io.ReadAll(res.Body)
+
+		timing := dataflow.ResponseTiming(res)
+		if assert.NotNil(t, timing) {
+			assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), timing.RemoteAddr)
+			assert.GreaterOrEqual(t, int64(timing.ServerProcessing), int64(10*time.Millisecond))
+			assert.GreaterOrEqual(t, int64(timing.Total), int64(timing.TimeToFirstByte))
+			assert.Equal(t, i == 1, timing.ConnReused)
+		}
+	}
+	assert.Len(t, timings, 2)
+	assert.Greater(t, int64(timings[0].Connect), int64(0))
+	assert.Equal(t, time.Duration(0), timings[1].Connect)
+}
+
+func TestTraceMiddleware_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	helper, err := NewRequestHelper(&Config{
+		Config:  &client.Config{Tls: client.TlsOptions{InsecureSkipVerify: true}},
+		BaseUrl: server.URL,
+	})
+	assert.NoError(t, err)
+	helper.WithMiddleware(TraceMiddleware(TraceConfig{}))
+
+	res, err := helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	if timing := dataflow.ResponseTiming(res); assert.NotNil(t, timing) {
+		assert.Greater(t, int64(timing.TLSHandshake), int64(0))
+		assert.False(t, timing.ConnReused)
+	}
+}
+
+func TestResponseTiming_WithoutTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	res, err := newTestHelper(t, server).Df().Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Nil(t, dataflow.ResponseTiming(res))
+}
@@ -0,0 +1,152 @@
+package httphelper
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// SpanData 结束的 span
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	// Parent 父 span, 没有父 span 时无效
+	Parent            SpanContext
+	Start             time.Time
+	End               time.Time
+	Attributes        map[string]interface{}
+	Events            []SpanEvent
+	Errors            []error
+	Failed            bool
+	StatusDescription string
+}
+
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// SpanExporter 接收结束且被采样的 span
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// NewTracer 返回内置的 Tracer, 延续 context 中的父链路与采样标记, 没有父链路时创建新的被采样的链路.
+// exporter 为 nil 时不导出 span
+func NewTracer(exporter SpanExporter) Tracer {
+	return &basicTracer{exporter: exporter}
+}
+
+type basicTracer struct {
+	exporter SpanExporter
+}
+
+func (t *basicTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	s := &basicSpan{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: make(map[string]interface{}, len(attributes)),
+		},
+	}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.data.Parent = parent
+		s.data.SpanContext = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+	} else {
+		_, _ = rand.Read(s.data.SpanContext.TraceID[:])
+		s.data.SpanContext.Sampled = true
+	}
+	_, _ = rand.Read(s.data.SpanContext.SpanID[:])
+	s.SetAttributes(attributes...)
+	return ContextWithSpanContext(ctx, s.data.SpanContext), s
+}
+
+type basicSpan struct {
+	tracer *basicTracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *basicSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *basicSpan) SetAttributes(attributes ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attribute := range attributes {
+		s.data.Attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (s *basicSpan) AddEvent(name string, attributes ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event := SpanEvent{Name: name, Time: time.Now(), Attributes: make(map[string]interface{}, len(attributes))}
+	for _, attribute := range attributes {
+		event.Attributes[attribute.Key] = attribute.Value
+	}
+	s.data.Events = append(s.data.Events, event)
+}
+
+func (s *basicSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *basicSpan) SetError(description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Failed = true
+	s.data.StatusDescription = description
+}
+
+func (s *basicSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil && data.SpanContext.Sampled {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// InMemoryExporter 在内存中保存导出的 span, 用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 返回已导出的 span 副本
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
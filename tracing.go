@@ -0,0 +1,255 @@
+package httphelper
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/artisancloud/httphelper/dataflow"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SpanContext W3C Trace Context 中的链路标识
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+	// Remote 是否从上游请求中解析得到
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent 返回 W3C traceparent 请求头的值
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceIDString() + "-" + sc.SpanIDString() + "-" + flags
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 在 context 中放入上游的链路标识, 通过 Dataflow.WithContext 传入后 TracingMiddleware 会延续该链路
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 返回 context 中的链路标识
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// ExtractSpanContext 从请求头解析 W3C traceparent 与 tracestate, 用于服务端将收到的链路传递给下游请求
+func ExtractSpanContext(header http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags&1 == 1
+	sc.TraceState = strings.Join(header.Values("tracestate"), ",")
+	sc.Remote = true
+	return sc, true
+}
+
+func decodeHex(dst []byte, value string) bool {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(value))
+	return err == nil
+}
+
+// Attribute span 属性
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer 链路追踪接口, 可以通过适配器对接 OpenTelemetry 等实现
+type Tracer interface {
+	// Start 创建客户端 span, ctx 中可能带有父链路, 返回的 ctx 需要包含新的 span
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attributes ...Attribute)
+	AddEvent(name string, attributes ...Attribute)
+	RecordError(err error)
+	// SetError 将 span 标记为失败
+	SetError(description string)
+	End()
+}
+
+// B3Format B3 请求头格式
+type B3Format int
+
+const (
+	B3None B3Format = iota
+	// B3Single 单个 b3 请求头
+	B3Single
+	// B3Multi X-B3-TraceId, X-B3-SpanId, X-B3-Sampled 多个请求头
+	B3Multi
+)
+
+type TracingConfig struct {
+	// Tracer 默认使用不导出 span 的 NewTracer(nil), 只传播链路
+	Tracer Tracer
+	// B3 除 W3C traceparent 外额外注入的 B3 请求头
+	B3 B3Format
+	// SpanName 默认为请求方法, 设置了路由模板时为 "方法 路由模板"
+	SpanName func(request *http.Request) string
+	// RedactQuery 记录 url.full 时脱敏的查询参数, 默认与 LoggingConfig.RedactQuery 相同
+	RedactQuery []string
+}
+
+func (c *TracingConfig) Default() {
+	if c.Tracer == nil {
+		c.Tracer = NewTracer(nil)
+	}
+	if c.SpanName == nil {
+		c.SpanName = defaultSpanName
+	}
+	if c.RedactQuery == nil {
+		c.RedactQuery = defaultRedactQuery
+	}
+}
+
+func defaultSpanName(request *http.Request) string {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if route, ok := dataflow.RouteFromContext(request.Context()); ok {
+		return method + " " + route
+	}
+	return method
+}
+
+type tracingStateKey struct{}
+
+// tracingState 记录当前请求的 span, 供重试中间件记录重试次数
+type tracingState struct {
+	retries int32
+	span    Span
+}
+
+// recordRetry 在 TracingMiddleware 创建的 span 上记录一次重试
+func recordRetry(ctx context.Context, attempt int, wait time.Duration, err error) {
+	state, ok := ctx.Value(tracingStateKey{}).(*tracingState)
+	if !ok {
+		return
+	}
+	atomic.AddInt32(&state.retries, 1)
+	attributes := []Attribute{{Key: "http.request.resend_count", Value: attempt - 1}, {Key: "retry.wait", Value: wait.String()}}
+	if err != nil {
+		attributes = append(attributes, Attribute{Key: "error.type", Value: string(ClassifyError(err))})
+	}
+	state.span.AddEvent("retry", attributes...)
+}
+
+// TracingMiddleware 为每个请求创建客户端 span, 注入 traceparent/tracestate 请求头,
+// 记录方法, URL, 状态码, 重试次数与错误. 需要记录重试时应放在 RetryMiddleware 之前
+func TracingMiddleware(config TracingConfig) dataflow.RequestMiddleware {
+	config.Default()
+	r := newRedactor(nil, config.RedactQuery, nil)
+	return func(handle dataflow.RequestHandle) dataflow.RequestHandle {
+		return func(request *http.Request, response *http.Response) error {
+			method := request.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			attributes := []Attribute{
+				{Key: "http.request.method", Value: method},
+				{Key: "url.full", Value: r.url(request.URL)},
+				{Key: "server.address", Value: request.URL.Hostname()},
+			}
+			if port := request.URL.Port(); port != "" {
+				attributes = append(attributes, Attribute{Key: "server.port", Value: port})
+			}
+			if route, ok := dataflow.RouteFromContext(request.Context()); ok {
+				attributes = append(attributes, Attribute{Key: "http.route", Value: route})
+			}
+
+			ctx, span := config.Tracer.Start(request.Context(), config.SpanName(request), attributes...)
+			defer span.End()
+			state := &tracingState{span: span}
+			ctx = context.WithValue(ctx, tracingStateKey{}, state)
+
+			// 不修改调用方的请求头
+			request = request.WithContext(ctx)
+			request.Header = request.Header.Clone()
+			if request.Header == nil {
+				request.Header = make(http.Header)
+			}
+			injectSpanContext(request.Header, span.SpanContext(), config.B3)
+
+			err := handle(request, response)
+
+			if retries := atomic.LoadInt32(&state.retries); retries > 0 {
+				span.SetAttributes(Attribute{Key: "http.request.resend_count", Value: int(retries)})
+			}
+			if err != nil {
+				span.SetAttributes(Attribute{Key: "error.type", Value: string(ClassifyError(err))})
+				span.RecordError(err)
+				span.SetError(err.Error())
+				return err
+			}
+			span.SetAttributes(Attribute{Key: "http.response.status_code", Value: response.StatusCode})
+			if response.StatusCode >= http.StatusBadRequest {
+				span.SetAttributes(Attribute{Key: "error.type", Value: strconv.Itoa(response.StatusCode)})
+				span.SetError(http.StatusText(response.StatusCode))
+			}
+			return nil
+		}
+	}
+}
+
+func injectSpanContext(header http.Header, sc SpanContext, b3 B3Format) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set("tracestate", sc.TraceState)
+	} else {
+		header.Del("tracestate")
+	}
+
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+	switch b3 {
+	case B3Single:
+		header.Set("b3", sc.TraceIDString()+"-"+sc.SpanIDString()+"-"+sampled)
+	case B3Multi:
+		header.Set("X-B3-TraceId", sc.TraceIDString())
+		header.Set("X-B3-SpanId", sc.SpanIDString())
+		header.Set("X-B3-Sampled", sampled)
+	}
+}
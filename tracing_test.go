@@ -0,0 +1,169 @@
+package httphelper
+
+import (
+	"context"
+	"github.com/artisancloud/httphelper/dataflow"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TracingMiddleware(TracingConfig{Tracer: NewTracer(exporter), B3: B3Single}))
+
+	parent, ok := ExtractSpanContext(http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":  {"vendor=value"},
+	})
+	assert.True(t, ok)
+	ctx := ContextWithSpanContext(context.Background(), parent)
+	_, err := helper.Df().WithContext(dataflow.WithRoute(ctx, "/users/{id}")).Uri("/users/1").Query("access_token", "t0ken").Query("page", "2").Request()
+	assert.NoError(t, err)
+
+	spans := exporter.Spans()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+	span := spans[0]
+	assert.Equal(t, "GET /users/{id}", span.Name)
+	assert.Equal(t, parent.TraceID, span.SpanContext.TraceID)
+	assert.Equal(t, parent.SpanID, span.Parent.SpanID)
+	assert.NotEqual(t, parent.SpanID, span.SpanContext.SpanID)
+	assert.Equal(t, span.SpanContext.Traceparent(), header.Get("traceparent"))
+	assert.Equal(t, "vendor=value", header.Get("tracestate"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext.SpanIDString()+"-1", header.Get("b3"))
+
+	assert.Equal(t, "GET", span.Attributes["http.request.method"])
+	// 敏感的查询参数脱敏后记录
+	assert.Equal(t, server.URL+"/users/1?access_token="+url.QueryEscape(redacted)+"&page=2", span.Attributes["url.full"])
+	assert.Equal(t, "/users/{id}", span.Attributes["http.route"])
+	assert.Equal(t, http.StatusNotFound, span.Attributes["http.response.status_code"])
+	assert.Equal(t, "404", span.Attributes["error.type"])
+	assert.True(t, span.Failed)
+}
+
+func TestTracingMiddleware_NewTrace(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TracingMiddleware(TracingConfig{Tracer: NewTracer(exporter), B3: B3Multi}))
+
+	df := helper.Df()
+	_, err := df.Uri("/").Header("X-Custom", "1").Request()
+	assert.NoError(t, err)
+
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.False(t, spans[0].Parent.IsValid())
+		assert.False(t, spans[0].Failed)
+		sc, ok := ExtractSpanContext(header)
+		assert.True(t, ok)
+		assert.Equal(t, spans[0].SpanContext.TraceID, sc.TraceID)
+		assert.True(t, sc.Sampled)
+		assert.Equal(t, sc.TraceIDString(), header.Get("X-B3-TraceId"))
+		assert.Equal(t, sc.SpanIDString(), header.Get("X-B3-SpanId"))
+		assert.Equal(t, "1", header.Get("X-B3-Sampled"))
+	}
+}
+
+func TestTracingMiddleware_Retry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(
+		TracingMiddleware(TracingConfig{Tracer: NewTracer(exporter)}),
+		RetryMiddleware(RetryPolicy{InitialInterval: time.Millisecond}),
+	)
+
+	_, err := helper.Df().Uri("/").Request()
+	assert.NoError(t, err)
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, 1, spans[0].Attributes["http.request.resend_count"])
+		assert.Equal(t, http.StatusOK, spans[0].Attributes["http.response.status_code"])
+		if assert.Len(t, spans[0].Events, 1) {
+			assert.Equal(t, "retry", spans[0].Events[0].Name)
+		}
+	}
+}
+
+func TestTracingMiddleware_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	helper := newTestHelper(t, server)
+	server.Close()
+
+	exporter := NewInMemoryExporter()
+	helper.WithMiddleware(TracingMiddleware(TracingConfig{Tracer: NewTracer(exporter)}))
+	_, err := helper.Df().Uri("/").Request()
+	assert.Error(t, err)
+
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.True(t, spans[0].Failed)
+		assert.Equal(t, "connection", spans[0].Attributes["error.type"])
+		assert.Len(t, spans[0].Errors, 1)
+	}
+}
+
+func TestTracingMiddleware_Unsampled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.Header.Get("traceparent"), "-00"))
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	helper := newTestHelper(t, server)
+	helper.WithMiddleware(TracingMiddleware(TracingConfig{Tracer: NewTracer(exporter)}))
+
+	parent, _ := ExtractSpanContext(http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}})
+	_, err := helper.Df().WithContext(ContextWithSpanContext(context.Background(), parent)).Uri("/").Request()
+	assert.NoError(t, err)
+	assert.Len(t, exporter.Spans(), 0)
+}
+
+func TestExtractSpanContext(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ExtractSpanContext(http.Header{"Traceparent": {value}})
+		assert.False(t, ok, value)
+	}
+
+	// 更高的版本允许附加字段
+	sc, ok := ExtractSpanContext(http.Header{"Traceparent": {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"}})
+	assert.True(t, ok)
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+}